@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/tyzbit/btcapi"
 )
 
 // AddressInfo represents information about a given address.
@@ -13,11 +15,20 @@ type AddressInfo struct {
 	Address                 string `gorm:"primaryKey"`
 	Nickname                string
 	BalanceSat              int
+	ConfirmedBalanceSat     int
+	PendingBalanceSat       int
+	SpendableBalanceSat     int
 	PreviousBalanceSat      int
 	Currency                string
 	BalanceCurrency         string
 	PreviousBalanceCurrency string
 	TXCount                 int
+	// TransactionsScanned is set once the existing transactions
+	// have been stored, so they aren't reported as new
+	TransactionsScanned bool
+	// Paused watches aren't checked until they're resumed
+	Paused bool
+	WatchSettings
 }
 
 // GetIdentifier returns the address of the AddressInfo variable.
@@ -30,10 +41,37 @@ func (a AddressInfo) GetNickname() string {
 	return a.Nickname
 }
 
+// BalanceEvent returns a BalanceEvent describing the AddressInfo variable
+func (a AddressInfo) BalanceEvent() BalanceEvent {
+	return BalanceEvent{
+		Type:                    EventBalanceChanged,
+		Priority:                PriorityNormal,
+		Network:                 chainParams.Name,
+		Kind:                    KindAddress,
+		Identifier:              a.Address,
+		Nickname:                a.Nickname,
+		BalanceSat:              a.BalanceSat,
+		ConfirmedBalanceSat:     a.ConfirmedBalanceSat,
+		PendingBalanceSat:       a.PendingBalanceSat,
+		SpendableBalanceSat:     a.SpendableBalanceSat,
+		PreviousBalanceSat:      a.PreviousBalanceSat,
+		Currency:                a.Currency,
+		BalanceCurrency:         a.BalanceCurrency,
+		PreviousBalanceCurrency: a.PreviousBalanceCurrency,
+		TXCount:                 a.TXCount,
+		Notifiers:               a.Notifiers,
+		Template:                a.Template,
+		Time:                    time.Now(),
+	}
+}
+
 // Update updates the database with the AddressInfo variable.
 func (a AddressInfo) Update(w Watcher) error {
 	tx := w.DB.Model(&AddressInfo{}).
 		Where(&AddressInfo{Address: a.Address, Nickname: a.Nickname}).
+		// Select all columns so balances going to zero are saved, but leave
+		// out the ones checks don't change
+		Select("*").Omit(checkOmittedColumns...).
 		Updates(&a)
 	if tx.RowsAffected != 1 {
 		return fmt.Errorf("%d rows affected", tx.RowsAffected)
@@ -42,82 +80,85 @@ func (a AddressInfo) Update(w Watcher) error {
 }
 
 const (
-	addressMessageTemplate = `**Address Balance Changed**
+	addressMessageTemplate = `**{{ .Title }}**
 Nickname: {{ .Nickname }}
-Address: {{ .Address }}
+Address: {{ .Identifier }}
 Previous Balance (satoshis): {{ .PreviousBalanceSat }}
 Previous Balance ({{ .Currency }}): {{ .PreviousBalanceCurrency }}
 Transactions: {{ .TXCount }}
 New Balance (satoshis): {{ .BalanceSat }}
 New Balance ({{ .Currency }}): {{ .BalanceCurrency }}
-`
+{{ if .PendingBalanceSat }}Confirmed Balance (satoshis): {{ .ConfirmedBalanceSat }}
+Pending Balance (satoshis): {{ .PendingBalanceSat }}
+{{ end }}{{ if ne .SpendableBalanceSat .BalanceSat }}Spendable Balance (satoshis): {{ .SpendableBalanceSat }}
+{{ end }}{{ range .Transactions }}Transaction: {{ .TXID }}
+  {{ .Direction }} {{ .NetSat }} sats, fee {{ .FeeSat }} sats, {{ .Status }}
+{{ if .DustSat }}  including {{ .DustSat }} sats of dust
+{{ end }}{{ end }}`
 )
 
-// WatchAddress takes a btcapi config and a nickname:address string. It
-// checks the database for a previous address summary and compares the
-// previous balance to the current balance. If they are different,
-// it calls Watcher.SendNotification.
-func (w Watcher) WatchAddress(stop chan bool, address string) {
-main:
-	for {
-		select {
-		case <-stop:
-			return
-		default:
-			nickname := w.GetNickname(address)
-			oldAddressInfo := w.GetAddressInfo(address)
-			// Insert blank AddressInfo if none was found
-			if (oldAddressInfo == AddressInfo{}) {
-				var err error
-				oldAddressInfo, err = w.CreateNewAddressInfo(address, nickname)
-				if err != nil {
-					log.Error(err)
-					return
-				}
-			}
-
-			addressSummary, err := w.BTCAPI.AddressSummary(address)
-			if err != nil {
-				log.Errorf("error calling btcapi: %v", err)
-			}
-
-			currencyBalance, err := w.ConvertBalance(oldAddressInfo.Currency, addressSummary.TXHistory.BalanceSat)
-			if err != nil || currencyBalance == nil {
-				log.Errorf("unable to convert balance of %d to %s, err: %v", addressSummary.TXHistory.BalanceSat, w.Currency, err)
-				currencyBalance[0] = "0.00"
-			}
-			addressInfo := AddressInfo{
-				Address:                 address,
-				Nickname:                nickname,
-				BalanceSat:              addressSummary.TXHistory.BalanceSat,
-				BalanceCurrency:         currencyBalance[0],
-				Currency:                oldAddressInfo.Currency,
-				PreviousBalanceSat:      oldAddressInfo.BalanceSat,
-				PreviousBalanceCurrency: oldAddressInfo.BalanceCurrency,
-				TXCount:                 addressSummary.TXHistory.TXCount,
-			}
-
-			if addressInfo.BalanceSat != oldAddressInfo.BalanceSat {
-				log.Infof("\"%s\" (%s) balance updated from %d to %d sats", nickname, address, oldAddressInfo.BalanceSat, addressInfo.BalanceSat)
-				w.UpdateInfo(addressInfo)
-				w.SendNotification(addressInfo, addressMessageTemplate)
-			}
-			// Check every second for a stop signal
-			for i := 0; i < w.SleepInterval; i++ {
-				select {
-				case <-stop:
-					break main
-				default:
-					time.Sleep(time.Second)
-				}
-			}
-		}
+// CheckAddress checks the database for a previous address summary and
+// compares the previous balance and transactions to the current ones.
+// If they are different, it calls Watcher.ReportChanges. Nothing is
+// saved or reported if ctx is cancelled, since the address may have been
+// removed. If mempoolOnly is true, only new transactions are looked for
+// (see CheckTransactions).
+func (w Watcher) CheckAddress(ctx context.Context, address string, mempoolOnly bool) error {
+	nickname := w.GetNickname(address)
+	oldAddressInfo := w.GetAddressInfo(ctx, address)
+	// The information is saved when the address is added, so
+	// it's missing if the address was removed since
+	if (oldAddressInfo == AddressInfo{}) {
+		return fmt.Errorf("no information saved for address %s", address)
 	}
+
+	addressSummary, err := w.Explorer.AddressSummary(ctx, address)
+	if err != nil {
+		return fmt.Errorf("error calling explorer: %w", err)
+	}
+
+	balanceCurrency := "0.00"
+	currencyBalance, err := w.ConvertBalance(ctx, oldAddressInfo.Currency, addressSummary.TXHistory.BalanceSat)
+	if err != nil || currencyBalance == nil {
+		log.Errorf("unable to convert balance of %d to %s, err: %v", addressSummary.TXHistory.BalanceSat, w.Currency, err)
+	} else {
+		balanceCurrency = currencyBalance[0]
+	}
+	addressInfo := AddressInfo{
+		Address:                 address,
+		Nickname:                nickname,
+		BalanceSat:              addressSummary.TXHistory.BalanceSat,
+		BalanceCurrency:         balanceCurrency,
+		Currency:                oldAddressInfo.Currency,
+		PreviousBalanceSat:      oldAddressInfo.BalanceSat,
+		PreviousBalanceCurrency: oldAddressInfo.BalanceCurrency,
+		TXCount:                 addressSummary.TXHistory.TXCount,
+		TransactionsScanned:     true,
+		WatchSettings:           oldAddressInfo.WatchSettings,
+	}
+	// Keep the previous balance if only the confirmation status changed
+	if addressInfo.BalanceSat == oldAddressInfo.BalanceSat {
+		addressInfo.PreviousBalanceSat = oldAddressInfo.PreviousBalanceSat
+		addressInfo.PreviousBalanceCurrency = oldAddressInfo.PreviousBalanceCurrency
+	}
+
+	summaries := []btcapi.AddressSummary{addressSummary}
+	changes := w.CheckTransactions(ctx, address, summaries, !oldAddressInfo.TransactionsScanned, oldAddressInfo.WatchSettings, mempoolOnly)
+	addressInfo.PendingBalanceSat = w.PendingBalance(address)
+	addressInfo.ConfirmedBalanceSat = addressInfo.BalanceSat - addressInfo.PendingBalanceSat
+	addressInfo.SpendableBalanceSat = addressInfo.BalanceSat - w.DustBalance(address)
+
+	if ctx.Err() != nil {
+		log.Debugf("stopped checking %s", address)
+		return nil
+	}
+	w.ReportChanges(ctx, oldAddressInfo, addressInfo, !oldAddressInfo.TransactionsScanned, changes)
+	return nil
 }
 
 // CreateNewAddressInfo creates an AddressInfo database entry for a new
-// address & nickname combination.
-func (w Watcher) CreateNewAddressInfo(address string, nickname string) (AddressInfo, error) {
+// address & nickname combination with the provided settings.
+func (w Watcher) CreateNewAddressInfo(address string, nickname string, settings WatchSettings) (AddressInfo, error) {
 	log.Warnf("previous address information for \"%s\" (%s) was not found, database will be updated", nickname, address)
 	addressInfo := AddressInfo{
 		Address:                 address,
@@ -128,6 +169,7 @@ func (w Watcher) CreateNewAddressInfo(address string, nickname string) (AddressI
 		PreviousBalanceSat:      0,
 		PreviousBalanceCurrency: "0.00",
 		TXCount:                 0,
+		WatchSettings:           settings,
 	}
 
 	tx := w.DB.Model(&AddressInfo{}).Create(&addressInfo)
@@ -138,14 +180,14 @@ func (w Watcher) CreateNewAddressInfo(address string, nickname string) (AddressI
 }
 
 // Gets an AddressInfo object from the database identified by an address
-func (w Watcher) GetAddressInfo(address string) (a AddressInfo) {
+func (w Watcher) GetAddressInfo(ctx context.Context, address string) (a AddressInfo) {
 	w.DB.Model(&AddressInfo{}).
 		Where(&AddressInfo{Address: address}).
 		Scan(&a)
 	// Update the object with current exchange rates
 	if (a != AddressInfo{}) {
 		var err error
-		bs, err := w.ConvertBalance(a.Currency, a.PreviousBalanceSat, a.BalanceSat)
+		bs, err := w.ConvertBalance(ctx, a.Currency, a.PreviousBalanceSat, a.BalanceSat)
 		if err != nil || bs == nil {
 			log.Errorf("error converting balance, err: %v", err)
 			return a
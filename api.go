@@ -6,8 +6,11 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 // IdentifierPOST is used to get balances
@@ -21,6 +24,7 @@ type IdentifierPOST struct {
 type AddWatchPOST struct {
 	Identifier string `json:"identifier"`
 	Nickname   string `json:"nickname"`
+	WatchSettings
 }
 
 // AddWatchResponse is the response from an
@@ -43,6 +47,13 @@ type BalancesResponse struct {
 	Pubkeys   []PubkeyInfo  `json:"pubkeys,omitempty"`
 }
 
+// WatchControlResponse is the response from a
+// PauseWatch, ResumeWatch or CheckWatchNow request
+type WatchControlResponse struct {
+	Paused bool   `json:"paused"`
+	Errors string `json:"errors,omitempty"`
+}
+
 // GetWatchesResponse is the response from a
 // GetWatches request
 type GetWatchesResponse []Watches
@@ -55,10 +66,16 @@ type Watches struct {
 }
 
 // IsPubkey returns boolean if the string passed looks like a pubkey
+// of any network. Output descriptors are watched like pubkeys.
 func IsPubkey(i string) bool {
-	return strings.HasPrefix(i, "xpub") ||
-		strings.HasPrefix(i, "ypub") ||
-		strings.HasPrefix(i, "zpub")
+	for _, n := range networks {
+		for _, t := range n.ExtendedKeyTypes {
+			if strings.HasPrefix(i, t.Prefix) {
+				return true
+			}
+		}
+	}
+	return IsDescriptor(i)
 }
 
 // AddWatch adds an identifier to be watched (address or pubkey)
@@ -73,6 +90,20 @@ func (w Watcher) AddWatch(c *gin.Context) {
 		return
 	}
 	response := AddWatchResponse{}
+	if err := w.ValidateWatchSettings(req.WatchSettings); err != nil {
+		status = http.StatusBadRequest
+		response.Errors = fmt.Sprint(err)
+		c.JSON(status, response)
+		return
+	}
+	identifier, err := ValidateIdentifier(req.Identifier)
+	if err != nil {
+		status = http.StatusBadRequest
+		response.Errors = fmt.Sprint(err)
+		c.JSON(status, response)
+		return
+	}
+	req.Identifier = identifier
 	if IsPubkey(req.Identifier) {
 		var oldPubkeyInfo PubkeyInfo
 		w.DB.Model(&PubkeyInfo{}).
@@ -86,16 +117,14 @@ func (w Watcher) AddWatch(c *gin.Context) {
 			c.JSON(status, response)
 			return
 		}
-		if _, err := w.CreateNewPubkeyInfo(req.Identifier, req.Nickname); err != nil {
+		if _, err := w.CreateNewPubkeyInfo(req.Identifier, req.Nickname, req.WatchSettings); err != nil {
 			status = http.StatusConflict
 			response.Errors = fmt.Sprint(err)
 			c.JSON(status, response)
 			return
 		}
-		cancel := make(chan bool, 1)
-		watcher.CancelWaitGroup.Add(1)
-		w.AddCancelSignal(req.Identifier, cancel)
-		go watcher.WatchPubkey(cancel, req.Identifier)
+		w.Watches.Add(req.Identifier)
+		w.Scheduler.Schedule(req.Identifier, time.Now())
 	} else {
 		var oldAddressInfo AddressInfo
 		w.DB.Model(&AddressInfo{}).
@@ -109,18 +138,60 @@ func (w Watcher) AddWatch(c *gin.Context) {
 			c.JSON(status, response)
 			return
 		}
-		if _, err := w.CreateNewAddressInfo(req.Identifier, req.Nickname); err != nil {
+		if _, err := w.CreateNewAddressInfo(req.Identifier, req.Nickname, req.WatchSettings); err != nil {
 			status = http.StatusInternalServerError
 			response.Errors = fmt.Sprint(err)
 			c.JSON(status, response)
 			return
 		}
-		cancel := make(chan bool, 1)
-		watcher.CancelWaitGroup.Add(1)
-		w.AddCancelSignal(req.Identifier, cancel)
-		go watcher.WatchAddress(cancel, req.Identifier)
+		w.Watches.Add(req.Identifier)
+		w.Scheduler.Schedule(req.Identifier, time.Now())
+	}
+	c.JSON(status, response)
+}
+
+// UpdateWatch replaces the nickname and settings of
+// an identifier (address or pubkey)
+func (w Watcher) UpdateWatch(c *gin.Context) {
+	status := http.StatusOK
+	body, _ := ioutil.ReadAll(c.Request.Body)
+	var req AddWatchPOST
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusInternalServerError, BalanceResponse{
+			Errors: fmt.Sprint(err),
+		})
+		return
+	}
+	req.Identifier = NormalizeIdentifier(req.Identifier)
+	response := AddWatchResponse{}
+	if err := w.ValidateWatchSettings(req.WatchSettings); err != nil {
+		status = http.StatusBadRequest
+		response.Errors = fmt.Sprint(err)
 		c.JSON(status, response)
+		return
+	}
+
+	columns := append([]string{"Nickname"}, watchSettingsColumns...)
+	var tx *gorm.DB
+	if IsPubkey(req.Identifier) {
+		tx = w.DB.Model(&PubkeyInfo{}).
+			Where(&PubkeyInfo{Pubkey: req.Identifier}).
+			Select(columns).
+			Updates(&PubkeyInfo{Nickname: req.Nickname, WatchSettings: req.WatchSettings})
+	} else {
+		tx = w.DB.Model(&AddressInfo{}).
+			Where(&AddressInfo{Address: req.Identifier}).
+			Select(columns).
+			Updates(&AddressInfo{Nickname: req.Nickname, WatchSettings: req.WatchSettings})
 	}
+	if tx.Error != nil {
+		status = http.StatusInternalServerError
+		response.Errors = fmt.Sprint(tx.Error)
+	} else if tx.RowsAffected != 1 {
+		status = http.StatusNotFound
+		response.Errors = "Identifier is not being watched"
+	}
+	c.JSON(status, response)
 }
 
 // GetNickname gets the nickname of an identifier (address or pubkey)
@@ -148,10 +219,11 @@ func (w Watcher) GetBalance(c *gin.Context) {
 		})
 		return
 	}
+	req.Identifier = NormalizeIdentifier(req.Identifier)
 
 	status := http.StatusOK
 	if IsPubkey(req.Identifier) {
-		pubkeyInfo := w.GetPubkeyInfo(req.Identifier)
+		pubkeyInfo := w.GetPubkeyInfo(c.Request.Context(), req.Identifier)
 		if (pubkeyInfo == PubkeyInfo{}) {
 			status = http.StatusNoContent
 		}
@@ -159,7 +231,7 @@ func (w Watcher) GetBalance(c *gin.Context) {
 			BalanceInfo: pubkeyInfo,
 		})
 	} else {
-		addressInfo := w.GetAddressInfo(req.Identifier)
+		addressInfo := w.GetAddressInfo(c.Request.Context(), req.Identifier)
 		if (addressInfo == AddressInfo{}) {
 			status = http.StatusNoContent
 		}
@@ -187,7 +259,7 @@ func (w Watcher) GetBalances(c *gin.Context) {
 func (w Watcher) GetWatches(c *gin.Context) {
 	status := http.StatusOK
 	response := GetWatchesResponse{}
-	for id := range w.CancelSignals {
+	for _, id := range w.Watches.Identifiers() {
 		response = append(response, Watches{
 			Identifier: id,
 			Nickname:   w.GetNickname(id),
@@ -210,13 +282,92 @@ func (w Watcher) DeleteIdentifier(c *gin.Context) {
 		})
 		return
 	}
+	req.Identifier = NormalizeIdentifier(req.Identifier)
 
 	status := http.StatusOK
-	w.CancelWaitGroup.Add(1)
-	w.DeleteCancelSignal(req.Identifier)
+	w.Scheduler.Remove(req.Identifier)
+	if w.Tip != nil {
+		w.Tip.Forget(req.Identifier)
+	}
+	w.Watches.Remove(req.Identifier)
+	w.DeleteBalanceHistory(req.Identifier)
+	w.DeleteTransactions(req.Identifier)
+	w.DeleteAlertRules(req.Identifier)
+	w.DeleteDustOutputs(req.Identifier)
+	w.DeleteDerivedAddresses(req.Identifier)
 	if IsPubkey(req.Identifier) {
 		c.JSON(status, w.DeletePubkeyInfo(req.Identifier))
 	} else {
 		c.JSON(status, w.DeleteAddressInfo(req.Identifier))
 	}
 }
+
+// PauseWatch stops checking an identifier (address or pubkey) until it's
+// resumed, keeping its balance, history and settings. A check that's
+// already running is left to finish.
+func (w Watcher) PauseWatch(c *gin.Context) {
+	w.setPaused(c, true)
+}
+
+// ResumeWatch starts checking a paused identifier (address or pubkey)
+// again, right away
+func (w Watcher) ResumeWatch(c *gin.Context) {
+	w.setPaused(c, false)
+}
+
+// setPaused pauses or resumes the identifier of a request
+func (w Watcher) setPaused(c *gin.Context, paused bool) {
+	body, _ := ioutil.ReadAll(c.Request.Body)
+	var req IdentifierPOST
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusInternalServerError, WatchControlResponse{
+			Errors: fmt.Sprint(err),
+		})
+		return
+	}
+	req.Identifier = NormalizeIdentifier(req.Identifier)
+
+	if !w.SetPaused(req.Identifier, paused) {
+		c.JSON(http.StatusNotFound, WatchControlResponse{
+			Errors: "Identifier is not being watched",
+		})
+		return
+	}
+	if paused {
+		w.Scheduler.Remove(req.Identifier)
+		log.Infof("paused \"%s\" (%s)", w.GetNickname(req.Identifier), req.Identifier)
+	} else {
+		w.Scheduler.Schedule(req.Identifier, time.Now())
+		log.Infof("resumed \"%s\" (%s)", w.GetNickname(req.Identifier), req.Identifier)
+	}
+	c.JSON(http.StatusOK, WatchControlResponse{Paused: paused})
+}
+
+// CheckWatchNow checks an identifier (address or pubkey) right away,
+// out of its usual cycle. Paused identifiers have to be resumed first.
+func (w Watcher) CheckWatchNow(c *gin.Context) {
+	body, _ := ioutil.ReadAll(c.Request.Body)
+	var req IdentifierPOST
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusInternalServerError, WatchControlResponse{
+			Errors: fmt.Sprint(err),
+		})
+		return
+	}
+	req.Identifier = NormalizeIdentifier(req.Identifier)
+
+	if _, ok := w.Watches.Context(req.Identifier); !ok {
+		c.JSON(http.StatusNotFound, WatchControlResponse{
+			Errors: "Identifier is not being watched",
+		})
+		return
+	}
+	if !w.Scheduler.RunNow(req.Identifier) {
+		c.JSON(http.StatusConflict, WatchControlResponse{
+			Paused: true,
+			Errors: "Identifier is paused, resume it to check it",
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, WatchControlResponse{})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newControlWatcher returns a Watcher watching address that sends
+// the identifiers its Scheduler checks on the returned channel
+func newControlWatcher(t *testing.T, address string) (Watcher, chan string) {
+	gin.SetMode(gin.TestMode)
+	checked := make(chan string, 100)
+	w := Watcher{DB: newTestDB(t), Watches: NewWatchRegistry()}
+	w.Scheduler = NewScheduler(1, 0, func(identifier string) { checked <- identifier },
+		func(string) time.Duration { return time.Hour })
+	ctx, cancel := context.WithCancel(context.Background())
+	go w.Scheduler.Run(ctx)
+	t.Cleanup(cancel)
+
+	w.DB.Create(&AddressInfo{Address: address, Nickname: "Wallet"})
+	w.Watches.Add(address)
+	return w, checked
+}
+
+// callHandler calls handler with a request with body and returns the response
+func callHandler(handler gin.HandlerFunc, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	handler(c)
+	return recorder
+}
+
+// paused returns whether address is saved as paused
+func paused(w Watcher, address string) bool {
+	var info AddressInfo
+	w.DB.Model(&AddressInfo{}).Where(&AddressInfo{Address: address}).First(&info)
+	return info.Paused
+}
+
+func TestPauseWatch(t *testing.T) {
+	address := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	w, checked := newControlWatcher(t, address)
+	request := `{"identifier":"` + address + `"}`
+	w.Scheduler.Schedule(address, time.Now().Add(50*time.Millisecond))
+
+	if r := callHandler(w.PauseWatch, request); r.Code != http.StatusOK {
+		t.Fatalf("pause: got %d %s", r.Code, r.Body.String())
+	}
+	if !paused(w, address) {
+		t.Error("pause wasn't saved")
+	}
+	if got := nextCheck(checked, 150*time.Millisecond); got != "" {
+		t.Fatalf("paused watch %s was checked", got)
+	}
+
+	// Resuming checks it right away and schedules it again
+	if r := callHandler(w.ResumeWatch, request); r.Code != http.StatusOK {
+		t.Fatalf("resume: got %d %s", r.Code, r.Body.String())
+	}
+	if paused(w, address) {
+		t.Error("resume wasn't saved")
+	}
+	if got := nextCheck(checked, time.Second); got != address {
+		t.Fatalf("got %q, want the resumed watch to be checked", got)
+	}
+	time.Sleep(10 * time.Millisecond)
+	w.Scheduler.lock.Lock()
+	defer w.Scheduler.lock.Unlock()
+	if len(w.Scheduler.queue) != 1 {
+		t.Errorf("%d checks are scheduled after resuming, want 1", len(w.Scheduler.queue))
+	}
+}
+
+func TestPauseUnknownWatch(t *testing.T) {
+	w, _ := newControlWatcher(t, "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4")
+	for _, handler := range []gin.HandlerFunc{w.PauseWatch, w.ResumeWatch} {
+		if r := callHandler(handler, `{"identifier":"bc1qnotwatched"}`); r.Code != http.StatusNotFound {
+			t.Errorf("got %d %s, want %d", r.Code, r.Body.String(), http.StatusNotFound)
+		}
+	}
+}
+
+func TestCheckWatchNow(t *testing.T) {
+	address := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	w, checked := newControlWatcher(t, address)
+	request := `{"identifier":"` + address + `"}`
+	w.Scheduler.Schedule(address, time.Now().Add(time.Hour))
+
+	if r := callHandler(w.CheckWatchNow, request); r.Code != http.StatusAccepted {
+		t.Fatalf("got %d %s, want %d", r.Code, r.Body.String(), http.StatusAccepted)
+	}
+	if got := nextCheck(checked, time.Second); got != address {
+		t.Fatalf("got %q, want the watch to be checked", got)
+	}
+
+	tests := []struct {
+		name       string
+		identifier string
+		status     int
+		want       string
+	}{
+		{"paused", address, http.StatusConflict, "paused"},
+		{"unknown", "bc1qnotwatched", http.StatusNotFound, "not being watched"},
+	}
+	callHandler(w.PauseWatch, request)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := callHandler(w.CheckWatchNow, `{"identifier":"`+test.identifier+`"}`)
+			if r.Code != test.status || !strings.Contains(r.Body.String(), test.want) {
+				t.Errorf("got %d %s, want %d", r.Code, r.Body.String(), test.status)
+			}
+		})
+	}
+	if got := nextCheck(checked, 100*time.Millisecond); got != "" {
+		t.Errorf("paused watch %s was checked", got)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Base58Encode encodes data with the bitcoin base58 alphabet
+func Base58Encode(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	encoded := []byte{}
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		encoded = append(encoded, base58Alphabet[mod.Int64()])
+	}
+	// Leading zero bytes are encoded as leading 1s
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, base58Alphabet[0])
+	}
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
+
+// Base58Decode decodes a base58 string
+func Base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for i, c := range s {
+		value := bytes.IndexRune([]byte(base58Alphabet), c)
+		if value < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q at position %d", c, i)
+		}
+		n.Mul(n, radix).Add(n, big.NewInt(int64(value)))
+	}
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+// checksum returns the first 4 bytes of the double SHA256 of data
+func checksum(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
+
+// Base58CheckEncode encodes data followed by its checksum
+func Base58CheckEncode(data []byte) string {
+	return Base58Encode(append(append([]byte{}, data...), checksum(data)...))
+}
+
+// Base58CheckDecode decodes a base58 string and verifies its checksum
+func Base58CheckDecode(s string) ([]byte, error) {
+	decoded, err := Base58Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) < 4 {
+		return nil, errors.New("too short to contain a checksum")
+	}
+	data, sum := decoded[:len(decoded)-4], decoded[len(decoded)-4:]
+	if !bytes.Equal(checksum(data), sum) {
+		return nil, errors.New("invalid base58 checksum")
+	}
+	return data, nil
+}
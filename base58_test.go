@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// Test vectors from bitcoin core's base58_encode_decode.json
+func TestBase58(t *testing.T) {
+	tests := []struct {
+		hex     string
+		encoded string
+	}{
+		{"", ""},
+		{"61", "2g"},
+		{"626262", "a3gV"},
+		{"636363", "aPEr"},
+		{"73696d706c792061206c6f6e6720737472696e67", "2cFupjhnEsSn59qHXstmK2ffpLv2"},
+		{"00eb15231dfceb60925886b67d065299925915aeb172c06647", "1NS17iag9jJgTHD1VXjvLCEnZuQ3rJDE9L"},
+		{"516b6fcd0f", "ABnLTmg"},
+		{"bf4f89001e670274dd", "3SEo3LWLoPntC"},
+		{"572e4794", "3EFU7m"},
+		{"ecac89cad93923c02321", "EJDM8drfXA6uyA"},
+		{"10c8511e", "Rt5zm"},
+		{"00000000000000000000", "1111111111"},
+	}
+	for _, test := range tests {
+		data, _ := hex.DecodeString(test.hex)
+		if got := Base58Encode(data); got != test.encoded {
+			t.Errorf("Base58Encode(%s) = %s, want %s", test.hex, got, test.encoded)
+		}
+		decoded, err := Base58Decode(test.encoded)
+		if err != nil {
+			t.Errorf("Base58Decode(%s): %v", test.encoded, err)
+		} else if !bytes.Equal(decoded, data) {
+			t.Errorf("Base58Decode(%s) = %x, want %s", test.encoded, decoded, test.hex)
+		}
+	}
+}
+
+func TestBase58Check(t *testing.T) {
+	tests := []struct {
+		encoded string
+		hex     string
+		wantErr bool
+	}{
+		// The address of the genesis block coinbase
+		{encoded: "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", hex: "0062e907b15cbf27d5425399ebf6f0fb50ebb88f18"},
+		{encoded: "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb", wantErr: true},
+		{encoded: "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfN0", wantErr: true},
+		{encoded: "3EFU", wantErr: true},
+		{encoded: "", wantErr: true},
+	}
+	for _, test := range tests {
+		data, err := Base58CheckDecode(test.encoded)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("Base58CheckDecode(%s) = %x, want an error", test.encoded, data)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Base58CheckDecode(%s): %v", test.encoded, err)
+			continue
+		}
+		if hex.EncodeToString(data) != test.hex {
+			t.Errorf("Base58CheckDecode(%s) = %x, want %s", test.encoded, data, test.hex)
+		}
+		if got := Base58CheckEncode(data); got != test.encoded {
+			t.Errorf("Base58CheckEncode(%x) = %s, want %s", data, got, test.encoded)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+	// Bech32Const and Bech32mConst are the checksum constants of
+	// bech32 (BIP173, witness v0) and bech32m (BIP350, witness v1+)
+	Bech32Const  uint32 = 1
+	Bech32mConst uint32 = 0x2bc830a3
+)
+
+func bech32Polymod(values []byte) uint32 {
+	generator := []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for _, c := range hrp {
+		expanded = append(expanded, byte(c>>5))
+	}
+	expanded = append(expanded, 0)
+	for _, c := range hrp {
+		expanded = append(expanded, byte(c&31))
+	}
+	return expanded
+}
+
+// convertBits regroups data from fromBits to toBits per byte
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	acc, bits := uint32(0), uint(0)
+	maxv := uint32(1)<<toBits - 1
+	converted := []byte{}
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, errors.New("invalid data range")
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			converted = append(converted, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			converted = append(converted, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return converted, nil
+}
+
+// Bech32Encode encodes 5-bit data with a human readable part,
+// using the checksum constant of bech32 or bech32m
+func Bech32Encode(hrp string, data []byte, constant uint32) string {
+	values := append(bech32HRPExpand(hrp), data...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ constant
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, d := range data {
+		b.WriteByte(bech32Charset[d])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(bech32Charset[polymod>>(5*(5-i))&31])
+	}
+	return b.String()
+}
+
+// Bech32Decode decodes a bech32 or bech32m string into its human readable
+// part and 5-bit data, returning the checksum constant it was encoded with
+func Bech32Decode(s string) (hrp string, data []byte, constant uint32, err error) {
+	if len(s) > 90 {
+		return "", nil, 0, fmt.Errorf("too long (%d characters, 90 at most)", len(s))
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, 0, errors.New("mixes upper and lower case")
+	}
+	s = strings.ToLower(s)
+	separator := strings.LastIndexByte(s, '1')
+	if separator < 1 || separator+7 > len(s) {
+		return "", nil, 0, errors.New("missing separator or checksum")
+	}
+	hrp = s[:separator]
+	for i, c := range hrp {
+		if c < 33 || c > 126 {
+			return "", nil, 0, fmt.Errorf("invalid character at position %d", i)
+		}
+	}
+	for i, c := range s[separator+1:] {
+		d := strings.IndexRune(bech32Charset, c)
+		if d < 0 {
+			return "", nil, 0, fmt.Errorf("invalid character %q at position %d", c, separator+1+i)
+		}
+		data = append(data, byte(d))
+	}
+	constant = bech32Polymod(append(bech32HRPExpand(hrp), data...))
+	if constant != Bech32Const && constant != Bech32mConst {
+		return "", nil, 0, errors.New("invalid bech32 checksum")
+	}
+	return hrp, data[:len(data)-6], constant, nil
+}
+
+// SegwitAddress encodes a witness program as a bech32 (v0)
+// or bech32m (v1+) address
+func SegwitAddress(hrp string, version byte, program []byte) (string, error) {
+	data, err := convertBits(program, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	constant := Bech32Const
+	if version > 0 {
+		constant = Bech32mConst
+	}
+	return Bech32Encode(hrp, append([]byte{version}, data...), constant), nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Valid and invalid strings from BIP173 and BIP350
+func TestBech32Decode(t *testing.T) {
+	valid := []struct {
+		s        string
+		constant uint32
+	}{
+		{"A12UEL5L", Bech32Const},
+		{"a12uel5l", Bech32Const},
+		{"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs", Bech32Const},
+		{"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw", Bech32Const},
+		{"11qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqc8247j", Bech32Const},
+		{"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w", Bech32Const},
+		{"?1ezyfcl", Bech32Const},
+		{"A1LQFN3A", Bech32mConst},
+		{"a1lqfn3a", Bech32mConst},
+		{"an83characterlonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11sg7hg6", Bech32mConst},
+		{"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx", Bech32mConst},
+		{"11llllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllllludsr8", Bech32mConst},
+		{"split1checkupstagehandshakeupstreamerranterredcaperredlc445v", Bech32mConst},
+		{"?1v759aa", Bech32mConst},
+	}
+	for _, test := range valid {
+		hrp, data, constant, err := Bech32Decode(test.s)
+		if err != nil {
+			t.Errorf("Bech32Decode(%s): %v", test.s, err)
+			continue
+		}
+		if constant != test.constant {
+			t.Errorf("Bech32Decode(%s) checksum constant %x, want %x", test.s, constant, test.constant)
+		}
+		if got := Bech32Encode(hrp, data, constant); got != strings.ToLower(test.s) {
+			t.Errorf("Bech32Encode(%s) = %s", test.s, got)
+		}
+	}
+
+	invalid := []string{
+		// bech32
+		"\x201nwldj5",
+		"\x7f1axkwrx",
+		"\x801eym55h",
+		"an84characterslonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1569pvx",
+		"pzry9x0s0muk",
+		"1pzry9x0s0muk",
+		"x1b4n0q5v",
+		"li1dgmt3",
+		"de1lg7wt\xff",
+		"A1G7SGD8",
+		"10a06t8",
+		"1qzzfhee",
+		// bech32m
+		"\x201xj0phk",
+		"\x7f1g6xzxy",
+		"\x801vctc34",
+		"an84characterslonghumanreadablepartthatcontainsthetheexcludedcharactersbioandnumber11d6pts4",
+		"qyrz8wqd2c9m",
+		"1qyrz8wqd2c9m",
+		"y1b0jsk6g",
+		"lt1igcx5c0",
+		"in1muywd",
+		"mm1crxm3i",
+		"au1s5cgom",
+		"M1VUXWEZ",
+		"16plkw9",
+		"1p2gdwpf",
+	}
+	for _, s := range invalid {
+		if _, _, _, err := Bech32Decode(s); err == nil {
+			t.Errorf("Bech32Decode(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+// Segwit addresses from BIP173 and BIP350
+func TestValidateSegwitAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		network string
+		wantErr bool
+	}{
+		{address: "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", network: NetworkMainnet},
+		{address: "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", network: NetworkTestnet},
+		{address: "bc1pw508d6qejxtdg4y5r3zarvary0c5xw7kw508d6qejxtdg4y5r3zarvary0c5xw7kt5nd6y", network: NetworkMainnet},
+		{address: "BC1SW50QGDZ25J", network: NetworkMainnet},
+		{address: "bc1zw508d6qejxtdg4y5r3zarvaryvaxxpcs", network: NetworkMainnet},
+		{address: "tb1qqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesrxh6hy", network: NetworkTestnet},
+		{address: "tb1pqqqqp399et2xygdj5xreqhjjvcmzhxw4aywxecjdzew6hylgvsesf3hn0c", network: NetworkTestnet},
+		{address: "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", network: NetworkMainnet},
+
+		// Invalid human readable part
+		{address: "tc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq5zuyut", network: NetworkTestnet, wantErr: true},
+		// Witness v1+ with a bech32 checksum
+		{address: "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd", network: NetworkMainnet, wantErr: true},
+		{address: "tb1z0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqglt7rf", network: NetworkTestnet, wantErr: true},
+		{address: "BC1S0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ54WELL", network: NetworkMainnet, wantErr: true},
+		// Witness v0 with a bech32m checksum
+		{address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh", network: NetworkMainnet, wantErr: true},
+		{address: "tb1q0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq24jc47", network: NetworkTestnet, wantErr: true},
+		// Invalid character in the checksum
+		{address: "bc1p38j9r5y49hruaue7wxjce0updqjuyyx0kh56v8s25huc6995vvpql3jow4", network: NetworkMainnet, wantErr: true},
+		// Witness version 17
+		{address: "BC130XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ7ZWS8R", network: NetworkMainnet, wantErr: true},
+		// Witness programs of 1, 41 and 16 (for v0) bytes
+		{address: "bc1pw5dgrnzv", network: NetworkMainnet, wantErr: true},
+		{address: "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7v8n0nx0muaewav253zgeav", network: NetworkMainnet, wantErr: true},
+		{address: "BC1QR508D6QEJXTDG4Y5R3ZARVARYV98GJ9P", network: NetworkMainnet, wantErr: true},
+		// Mixed case
+		{address: "tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vq47Zagq", network: NetworkTestnet, wantErr: true},
+		// More than 4 bits of padding, and non-zero padding
+		{address: "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7v07qwwzcrf", network: NetworkMainnet, wantErr: true},
+		{address: "tb1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vpggkg4j", network: NetworkTestnet, wantErr: true},
+		// Empty data
+		{address: "bc1gmk9yu", network: NetworkMainnet, wantErr: true},
+		// Valid, but for another network
+		{address: "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", network: NetworkMainnet, wantErr: true},
+	}
+	t.Cleanup(func() { SetNetwork(NetworkMainnet) })
+	for _, test := range tests {
+		if err := SetNetwork(test.network); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ValidateAddress(test.address)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ValidateAddress(%s) succeeded on %s, want an error", test.address, test.network)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ValidateAddress(%s) on %s: %v", test.address, test.network, err)
+		} else if got != strings.ToLower(test.address) {
+			t.Errorf("ValidateAddress(%s) = %s, want it in lowercase", test.address, got)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/tyzbit/btcapi"
+	"golang.org/x/crypto/ripemd160"
+)
+
+const (
+	OutputP2PKH      string = "p2pkh"
+	OutputP2SHP2WPKH string = "p2sh(p2wpkh)"
+	OutputP2WPKH     string = "p2wpkh"
+
+	// HardenedKeyStart is the first hardened child index, which can't
+	// be derived from a public key
+	HardenedKeyStart uint32 = 0x80000000
+	// extendedKeyLength is the length of a serialized extended
+	// key without its checksum
+	extendedKeyLength int = 78
+	// DefaultExtendedKeyLimit is how many addresses of each chain
+	// ExtendedPublicKeyDetails returns
+	DefaultExtendedKeyLimit int = 20
+)
+
+// ExtendedKeyType is a kind of extended public key, identified by its
+// version bytes, that derives a specific type of address
+type ExtendedKeyType struct {
+	Prefix         string
+	Version        uint32
+	OutputType     string
+	OutputTypeDesc string
+	BIP32Path      string
+}
+
+// ExtendedKey is a BIP32 extended public key
+type ExtendedKey struct {
+	Type              ExtendedKeyType
+	Depth             byte
+	ParentFingerprint []byte
+	ChildNumber       uint32
+	ChainCode         []byte
+	PublicKey         Point
+}
+
+// ParseExtendedKey decodes a base58 extended public key
+func ParseExtendedKey(s string) (ExtendedKey, error) {
+	data, err := Base58CheckDecode(s)
+	if err != nil {
+		return ExtendedKey{}, err
+	}
+	if len(data) != extendedKeyLength {
+		return ExtendedKey{}, fmt.Errorf("extended key is %d bytes, expected %d", len(data), extendedKeyLength)
+	}
+
+	version := binary.BigEndian.Uint32(data[:4])
+	k := ExtendedKey{
+		Depth:             data[4],
+		ParentFingerprint: data[5:9],
+		ChildNumber:       binary.BigEndian.Uint32(data[9:13]),
+		ChainCode:         data[13:45],
+	}
+	if k.Depth == 0 && (binary.BigEndian.Uint32(k.ParentFingerprint) != 0 || k.ChildNumber != 0) {
+		return ExtendedKey{}, errors.New("master key has a parent fingerprint or child number")
+	}
+	found := false
+	for _, t := range chainParams.ExtendedKeyTypes {
+		if t.Version == version {
+			k.Type, found = t, true
+		}
+	}
+	if !found {
+		others := otherNetworks(func(n Network) bool {
+			for _, t := range n.ExtendedKeyTypes {
+				if t.Version == version {
+					return true
+				}
+			}
+			return false
+		})
+		if others != "" {
+			return ExtendedKey{}, fmt.Errorf("%s is a %s key, but the network is %s", s[:4], others, chainParams.Name)
+		}
+		return ExtendedKey{}, fmt.Errorf("unsupported extended key version %08x", version)
+	}
+	if k.PublicKey, err = ParseCompressedPoint(data[45:]); err != nil {
+		return ExtendedKey{}, err
+	}
+	return k, nil
+}
+
+// String encodes the key in base58
+func (k ExtendedKey) String() string {
+	data := make([]byte, 0, extendedKeyLength)
+	data = append(data, uint32Bytes(k.Type.Version)...)
+	data = append(data, k.Depth)
+	data = append(data, k.ParentFingerprint...)
+	data = append(data, uint32Bytes(k.ChildNumber)...)
+	data = append(data, k.ChainCode...)
+	data = append(data, k.PublicKey.SerializeCompressed()...)
+	return Base58CheckEncode(data)
+}
+
+// Child derives the non-hardened child key at index i
+func (k ExtendedKey) Child(i uint32) (ExtendedKey, error) {
+	if i >= HardenedKeyStart {
+		return ExtendedKey{}, errors.New("hardened children can't be derived from a public key")
+	}
+	parent := k.PublicKey.SerializeCompressed()
+	mac := hmac.New(sha512.New, k.ChainCode)
+	mac.Write(parent)
+	mac.Write(uint32Bytes(i))
+	sum := mac.Sum(nil)
+
+	il := new(big.Int).SetBytes(sum[:32])
+	if il.Cmp(secp256k1.N) >= 0 {
+		return ExtendedKey{}, fmt.Errorf("child %d is invalid", i)
+	}
+	child := ScalarBaseMult(il).Add(k.PublicKey)
+	if child.IsInfinity() {
+		return ExtendedKey{}, fmt.Errorf("child %d is invalid", i)
+	}
+	return ExtendedKey{
+		Type:              k.Type,
+		Depth:             k.Depth + 1,
+		ParentFingerprint: hash160(parent)[:4],
+		ChildNumber:       i,
+		ChainCode:         sum[32:],
+		PublicKey:         child,
+	}, nil
+}
+
+// Address returns the address of the key's public key
+// for the output type of the key
+func (k ExtendedKey) Address() (string, error) {
+	return PubkeyAddress(k.Type.OutputType, k.PublicKey.SerializeCompressed())
+}
+
+// PubkeyAddress returns the address paying to a compressed public key
+func PubkeyAddress(outputType string, pubkey []byte) (string, error) {
+	switch outputType {
+	case OutputP2PKH:
+		return p2pkhAddress(hash160(pubkey)), nil
+	case OutputP2SHP2WPKH:
+		redeemScript := append([]byte{0x00, 0x14}, hash160(pubkey)...)
+		return p2shAddress(hash160(redeemScript)), nil
+	case OutputP2WPKH:
+		return witnessAddress(0, hash160(pubkey))
+	}
+	return "", fmt.Errorf("unsupported output type %s", outputType)
+}
+
+// p2pkhAddress returns the legacy address of a public key hash
+func p2pkhAddress(hash []byte) string {
+	return Base58CheckEncode(append([]byte{chainParams.PubKeyHashID}, hash...))
+}
+
+// p2shAddress returns the address of a script hash
+func p2shAddress(hash []byte) string {
+	return Base58CheckEncode(append([]byte{chainParams.ScriptHashID}, hash...))
+}
+
+// witnessAddress returns the segwit address of a witness program
+func witnessAddress(version byte, program []byte) (string, error) {
+	return SegwitAddress(chainParams.Bech32HRP, version, program)
+}
+
+// uint32Bytes serializes i as 4 big endian bytes
+func uint32Bytes(i uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, i)
+	return b
+}
+
+// hash160 returns RIPEMD160(SHA256(data))
+func hash160(data []byte) []byte {
+	sha := sha256.Sum256(data)
+	ripemd := ripemd160.New()
+	ripemd.Write(sha[:])
+	return ripemd.Sum(nil)
+}
+
+// DeriveAddresses returns the addresses of a chain (0 for receive,
+// 1 for change) of an extended key, starting at index offset
+func (k ExtendedKey) DeriveAddresses(chain uint32, offset int, limit int) ([]string, error) {
+	chainKey, err := k.Child(chain)
+	if err != nil {
+		return nil, err
+	}
+	addresses := []string{}
+	for i := offset; i < offset+limit; i++ {
+		child, err := chainKey.Child(uint32(i))
+		if err != nil {
+			return nil, err
+		}
+		address, err := child.Address()
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+// RelatedExtendedKeys returns pubkey encoded as each of the other extended
+// key types of the network, without deriving any addresses. Output
+// descriptors don't have related keys.
+func RelatedExtendedKeys(pubkey string) (keys []string, err error) {
+	if IsDescriptor(pubkey) {
+		return nil, nil
+	}
+	k, err := ParseExtendedKey(pubkey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extended public key: %w", err)
+	}
+	for _, t := range chainParams.ExtendedKeyTypes {
+		if t.Version == k.Type.Version {
+			continue
+		}
+		related := k
+		related.Type = t
+		keys = append(keys, related.String())
+	}
+	return keys, nil
+}
+
+// ExtendedPublicKeyDetails derives the first addresses of an extended
+// public key. See ExtendedPublicKeyDetailsPage.
+func (w Watcher) ExtendedPublicKeyDetails(pubkey string) (btcapi.ExtendedPublicKeyDetails, error) {
+	return w.ExtendedPublicKeyDetailsPage(pubkey, DefaultExtendedKeyLimit, 0)
+}
+
+// ExtendedPublicKeyDetailsPage derives the receive and change addresses of
+// an extended public key locally, so the key is never sent to BTC_RPC_API.
+// It returns the same details as btcapi.ExtendedPublicKeyDetailsPage.
+// Output descriptors are derived with DescriptorDetailsPage.
+func (w Watcher) ExtendedPublicKeyDetailsPage(pubkey string, limit int, offset int) (details btcapi.ExtendedPublicKeyDetails, err error) {
+	if IsDescriptor(pubkey) {
+		return DescriptorDetailsPage(pubkey, limit, offset)
+	}
+	k, err := ParseExtendedKey(pubkey)
+	if err != nil {
+		return details, fmt.Errorf("invalid extended public key: %w", err)
+	}
+
+	details.KeyType = k.Type.Prefix
+	details.OutputType = k.Type.OutputType
+	details.OutputTypeDesc = k.Type.OutputTypeDesc
+	details.BIP32Path = k.Type.BIP32Path
+	if details.ReceiveAddresses, err = k.DeriveAddresses(0, offset, limit); err != nil {
+		return details, fmt.Errorf("unable to derive receive addresses: %w", err)
+	}
+	if details.ChangeAddresses, err = k.DeriveAddresses(1, offset, limit); err != nil {
+		return details, fmt.Errorf("unable to derive change addresses: %w", err)
+	}
+
+	// The same key can be used with the other address types
+	for _, t := range chainParams.ExtendedKeyTypes {
+		if t.Version == k.Type.Version {
+			continue
+		}
+		related := k
+		related.Type = t
+		first, err := related.DeriveAddresses(0, 0, 1)
+		if err != nil {
+			return details, fmt.Errorf("unable to derive %s addresses: %w", t.Prefix, err)
+		}
+		details.RelatedKeys = append(details.RelatedKeys, btcapi.RelatedKey{
+			KeyType:      t.Prefix,
+			Key:          related.String(),
+			OutputType:   t.OutputType,
+			FirstAddress: first[0],
+		})
+	}
+	return details, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"testing"
+)
+
+// Public derivation steps of the BIP32 test vectors. Hardened
+// steps can't be derived from an extended public key, so each
+// case starts from the last key before a run of normal children.
+func TestExtendedKeyChild(t *testing.T) {
+	tests := []struct {
+		name   string
+		parent string
+		path   []uint32
+		want   string
+	}{
+		{
+			name:   "vector 1 m/0H/1",
+			parent: "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw",
+			path:   []uint32{1},
+			want:   "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ",
+		},
+		{
+			name:   "vector 1 m/0H/1/2H/2/1000000000",
+			parent: "xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5",
+			path:   []uint32{2, 1000000000},
+			want:   "xpub6H1LXWLaKsWFhvm6RVpEL9P4KfRZSW7abD2ttkWP3SSQvnyA8FSVqNTEcYFgJS2UaFcxupHiYkro49S8yGasTvXEYBVPamhGW6cFJodrTHy",
+		},
+		{
+			name:   "vector 2 m/0",
+			parent: "xpub661MyMwAqRbcFW31YEwpkMuc5THy2PSt5bDMsktWQcFF8syAmRUapSCGu8ED9W6oDMSgv6Zz8idoc4a6mr8BDzTJY47LJhkJ8UB7WEGuduB",
+			path:   []uint32{0},
+			want:   "xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			k, err := ParseExtendedKey(test.parent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k.String() != test.parent {
+				t.Errorf("String() = %s, want %s", k.String(), test.parent)
+			}
+			for _, i := range test.path {
+				if k, err = k.Child(i); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if k.String() != test.want {
+				t.Errorf("got %s, want %s", k.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestExtendedKeyHardenedChild(t *testing.T) {
+	k, err := ParseExtendedKey("xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Child(HardenedKeyStart); err == nil {
+		t.Error("derived a hardened child from a public key")
+	}
+}
+
+// Account keys and addresses from the BIP49 and BIP84 test vectors
+func TestDeriveAddresses(t *testing.T) {
+	tests := []struct {
+		name   string
+		pubkey string
+		chain  uint32
+		offset int
+		want   []string
+	}{
+		{
+			name:   "BIP49 receive",
+			pubkey: "ypub6Ww3ibxVfGzLrAH1PNcjyAWenMTbbAosGNB6VvmSEgytSER9azLDWCxoJwW7Ke7icmizBMXrzBx9979FfaHxHcrArf3zbeJJJUZPf663zsP",
+			want:   []string{"37VucYSaXLCAsxYyAPfbSi9eh4iEcbShgf"},
+		},
+		{
+			name:   "BIP84 receive",
+			pubkey: "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+			want:   []string{"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"},
+		},
+		{
+			name:   "BIP84 change",
+			pubkey: "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+			chain:  1,
+			want:   []string{"bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"},
+		},
+		{
+			name:   "BIP84 receive from an offset",
+			pubkey: "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+			offset: 1,
+			want:   []string{"bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			k, err := ParseExtendedKey(test.pubkey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			addresses, err := k.DeriveAddresses(test.chain, test.offset, len(test.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range test.want {
+				if addresses[i] != test.want[i] {
+					t.Errorf("address %d is %s, want %s", test.offset+i, addresses[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseExtendedKeyInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		pubkey  string
+		network string
+	}{
+		{
+			name:    "bad checksum",
+			pubkey:  "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet9",
+			network: NetworkMainnet,
+		},
+		{
+			name:    "wrong network",
+			pubkey:  "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8",
+			network: NetworkTestnet,
+		},
+		{
+			name:    "too short",
+			pubkey:  Base58CheckEncode(make([]byte, 77)),
+			network: NetworkMainnet,
+		},
+	}
+	t.Cleanup(func() { SetNetwork(NetworkMainnet) })
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := SetNetwork(test.network); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := ParseExtendedKey(test.pubkey); err == nil {
+				t.Error("parsed an invalid extended key")
+			}
+		})
+	}
+}
+
+func TestRelatedExtendedKeys(t *testing.T) {
+	zpub := "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+	keys, err := RelatedExtendedKeys(zpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The related keys are the ones ExtendedPublicKeyDetails returns
+	details, err := Watcher{}.ExtendedPublicKeyDetails(zpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || len(details.RelatedKeys) != len(keys) {
+		t.Fatalf("got %d related keys, want 2", len(keys))
+	}
+	for i, related := range details.RelatedKeys {
+		if keys[i] != related.Key {
+			t.Errorf("%s key is %s, want %s", related.KeyType, keys[i], related.Key)
+		}
+	}
+
+	if keys, err := RelatedExtendedKeys("wpkh(" + zpub + "/0/*)"); err != nil || len(keys) != 0 {
+		t.Errorf("got %v (%v) for a descriptor, want none", keys, err)
+	}
+	if _, err := RelatedExtendedKeys("zpub"); err == nil {
+		t.Error("invalid key didn't fail")
+	}
+}
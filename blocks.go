@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	PollModeInterval   string = "interval"
+	PollModeBlocks     string = "blocks"
+	DefaultTipInterval int    = 30
+	// MempoolLookahead is how many unused addresses after the last used
+	// one of each chain are checked between blocks
+	MempoolLookahead int = 1
+	// DefaultMempoolIntervalFactor sets the default MEMPOOL_INTERVAL
+	// as a multiple of SLEEP_INTERVAL
+	DefaultMempoolIntervalFactor int = 2
+)
+
+// TipTracker follows the tip of the chain in the blocks poll mode
+// and which tip each watch was last fully checked at
+type TipTracker struct {
+	lock   sync.Mutex
+	hash   string
+	height int
+	// checked maps each identifier to the tip hash of its last full check
+	checked map[string]string
+}
+
+// NewTipTracker returns a TipTracker that doesn't know the tip yet
+func NewTipTracker() *TipTracker {
+	return &TipTracker{checked: map[string]string{}}
+}
+
+// Tip returns the last seen tip hash and height
+func (t *TipTracker) Tip() (hash string, height int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.hash, t.height
+}
+
+// SetTip records a new tip and returns true if it changed
+func (t *TipTracker) SetTip(hash string, height int) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if hash == t.hash {
+		return false
+	}
+	t.hash = hash
+	t.height = height
+	return true
+}
+
+// NeedsFullCheck returns whether a watch hasn't been fully checked
+// at the current tip, along with the tip to pass to FullCheckDone
+func (t *TipTracker) NeedsFullCheck(identifier string) (bool, string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.hash == "" || t.checked[identifier] != t.hash, t.hash
+}
+
+// FullCheckDone records that a watch was fully checked at a tip
+func (t *TipTracker) FullCheckDone(identifier string, hash string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if hash != "" {
+		t.checked[identifier] = hash
+	}
+}
+
+// Forget removes a watch that is no longer watched
+func (t *TipTracker) Forget(identifier string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.checked, identifier)
+}
+
+// ParsePollMode checks POLL_MODE, returning it in lowercase
+func ParsePollMode(mode string) (string, error) {
+	mode = strings.ToLower(mode)
+	if mode != PollModeInterval && mode != PollModeBlocks {
+		return "", fmt.Errorf("unknown poll mode %q, expected %s or %s", mode, PollModeInterval, PollModeBlocks)
+	}
+	return mode, nil
+}
+
+// WatchTip checks the tip of the chain every TIP_INTERVAL seconds
+// until ctx is done. When it changes, every watch is checked
+// right away, which is when confirmed balances, confirmations and
+// reorganizations are checked in the blocks poll mode.
+func (w Watcher) WatchTip(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(w.TipInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		if hash, err := w.Explorer.TipHash(ctx); err != nil {
+			log.Errorf("unable to get tip hash: %v", err)
+		} else if previous, _ := w.Tip.Tip(); hash != previous {
+			height, err := w.Explorer.TipHeight(ctx)
+			if err != nil {
+				log.Errorf("unable to get tip height: %v", err)
+			} else if w.Tip.SetTip(hash, height) {
+				log.Infof("new block %d (%s), checking every watch", height, hash)
+				w.Scheduler.RunAll()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// TipHeight returns the height of the tip of the chain, which is
+// the last one seen by WatchTip in the blocks poll mode
+func (w Watcher) TipHeight(ctx context.Context) (int, error) {
+	if w.Tip != nil {
+		if _, height := w.Tip.Tip(); height > 0 {
+			return height, nil
+		}
+	}
+	return w.Explorer.TipHeight(ctx)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"math"
 )
@@ -15,29 +16,37 @@ const (
 // ConvertBalance takes a currency and one or more balances in satoshis and
 // returns the equivalent balance(s) in the currency specified with
 // two digits of precision.
-func (w Watcher) ConvertBalance(currency string, balancesSat ...int) (bs []string, err error) {
-	price, err := w.BTCAPI.Price()
+func (w Watcher) ConvertBalance(ctx context.Context, currency string, balancesSat ...int) (bs []string, err error) {
+	price, err := w.Price(ctx, currency)
 	if err != nil {
-		return nil, fmt.Errorf("error calling btcapi: %v", err)
+		return nil, err
 	}
 
 	for _, b := range balancesSat {	
-		balanceCurrency := 0.0
 		bitcoinBalance := float64(b) / float64(SatsPerBitcoin)
-		switch currency {
-		case CurrencyUSD:
-			balanceCurrency = price.USD * bitcoinBalance
-		case CurrencyEUR:
-			balanceCurrency = price.EUR * bitcoinBalance
-		case CurrencyGBP:
-			balanceCurrency = price.GBP * bitcoinBalance
-		case CurrencyXAU:
-			balanceCurrency = price.XAU * bitcoinBalance
-		default:
-			balanceCurrency = price.USD * bitcoinBalance
-		}
+		balanceCurrency := price * bitcoinBalance
 		bs = append(bs, fmt.Sprint(math.Round(balanceCurrency*100)/100))
 	}
 	// Round with two digits of precision
 	return bs, nil
 }
+
+// Price returns the price of one bitcoin in the currency specified.
+// Unknown currencies use USD.
+func (w Watcher) Price(ctx context.Context, currency string) (float64, error) {
+	price, err := w.Explorer.Price(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error calling explorer: %v", err)
+	}
+
+	switch currency {
+	case CurrencyEUR:
+		return price.EUR, nil
+	case CurrencyGBP:
+		return price.GBP, nil
+	case CurrencyXAU:
+		return price.XAU, nil
+	default:
+		return price.USD, nil
+	}
+}
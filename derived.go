@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tyzbit/btcapi"
+	"gorm.io/gorm"
+)
+
+const (
+	ChainReceive int = 0
+	ChainChange  int = 1
+)
+
+// DerivedAddress is an address derived from a watched pubkey or
+// descriptor, with the results of the last time it was checked
+type DerivedAddress struct {
+	Identifier string `gorm:"primaryKey"`
+	// Pubkey is the key the address was derived from, which is a
+	// related key of the identifier with CHECK_ALL_PUBKEY_TYPES
+	Pubkey      string `gorm:"primaryKey"`
+	Chain       int    `gorm:"primaryKey;autoIncrement:false"`
+	Index       int    `gorm:"primaryKey;column:address_index;autoIncrement:false"`
+	Address     string
+	TXCount     int
+	BalanceSat  int
+	LastChecked time.Time
+}
+
+// KeyScan is the result of checking the addresses of a pubkey
+type KeyScan struct {
+	BalanceSat int
+	TXCount    int
+	// UsedSummaries holds the summaries of addresses with transactions
+	UsedSummaries []btcapi.AddressSummary
+}
+
+// ScanPubkey checks the addresses of a pubkey that can have changed:
+// the ones that have been used, and the lookahead addresses after the
+// last used one on each chain (LOOKAHEAD for a full check). Unused
+// addresses before the last used one aren't checked again. The results
+// are saved, so the balance of the pubkey is the sum of every address
+// that was ever checked. It returns an error if ctx was cancelled or an
+// address couldn't be checked, since an address that wasn't checked
+// can't tell where the used addresses end.
+func (w Watcher) ScanPubkey(ctx context.Context, identifier string, pubkey string, lookahead int) (KeyScan, error) {
+	var scan KeyScan
+	for _, chain := range []int{ChainReceive, ChainChange} {
+		addresses := w.GetDerivedAddresses(identifier, pubkey, chain)
+		// lastUsed and batch are positions in addresses rather than
+		// address indexes, which don't have to start at 0 or be
+		// contiguous in the saved addresses
+		lastUsed := -1
+		for i, a := range addresses {
+			if a.TXCount > 0 {
+				lastUsed = i
+			}
+		}
+
+		// The first batch is every used address and the addresses after
+		// the last used one. If any of those turn out to be used, the
+		// addresses after it are checked in another batch, until a batch
+		// ends LOOKAHEAD unused addresses after the last used one.
+		batch := []int{}
+		for i := range addresses {
+			if addresses[i].TXCount > 0 {
+				batch = append(batch, i)
+			}
+		}
+		next := lastUsed + 1
+		for {
+			for ; next <= lastUsed+lookahead; next++ {
+				if next >= len(addresses) {
+					// Don't save new addresses of a removed watch
+					if err := ctx.Err(); err != nil {
+						return scan, err
+					}
+					offset := 0
+					if len(addresses) > 0 {
+						offset = addresses[len(addresses)-1].Index + 1
+					}
+					page, err := w.DeriveAddressPage(identifier, pubkey, chain, offset)
+					if err != nil {
+						return scan, fmt.Errorf("unable to derive addresses: %w", err)
+					}
+					// Descriptors that aren't ranged run out of addresses
+					if len(page) == 0 {
+						break
+					}
+					addresses = append(addresses, page...)
+				}
+				batch = append(batch, next)
+			}
+			if len(batch) == 0 {
+				break
+			}
+
+			// Appending can move addresses, so the pointers are
+			// only taken once the batch is complete
+			checked := make([]*DerivedAddress, len(batch))
+			for i, position := range batch {
+				checked[i] = &addresses[position]
+			}
+			used, err := w.CheckDerivedAddresses(ctx, checked)
+			if err != nil {
+				return scan, err
+			}
+			scan.UsedSummaries = append(scan.UsedSummaries, used...)
+			previousLastUsed := lastUsed
+			for _, position := range batch {
+				if addresses[position].TXCount > 0 && position > lastUsed {
+					lastUsed = position
+				}
+			}
+			if lastUsed == previousLastUsed {
+				break
+			}
+			batch = []int{}
+		}
+
+		for _, a := range addresses {
+			scan.BalanceSat = scan.BalanceSat + a.BalanceSat
+			scan.TXCount = scan.TXCount + a.TXCount
+		}
+	}
+	return scan, nil
+}
+
+// CheckDerivedAddresses looks up the summaries of addresses with up to
+// SCAN_WORKERS requests at a time, updating the addresses with the results.
+// Addresses that can't be looked up keep the results of their last check.
+// It returns the summaries of the used addresses, and an error if ctx was
+// cancelled or any address couldn't be looked up.
+func (w Watcher) CheckDerivedAddresses(ctx context.Context, addresses []*DerivedAddress) ([]btcapi.AddressSummary, error) {
+	jobs := make(chan *DerivedAddress)
+	used := []btcapi.AddressSummary{}
+	// failed is the first address that couldn't be looked up
+	var failed error
+	var lock sync.Mutex
+	var workers sync.WaitGroup
+	for i := 0; i < w.ScanWorkers && i < len(addresses); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for a := range jobs {
+				log.Debug("checking address: " + a.Address)
+				summary, err := w.Explorer.AddressSummary(ctx, a.Address)
+				if err != nil {
+					lock.Lock()
+					if failed == nil {
+						failed = fmt.Errorf("error checking address %s: %w", a.Address, err)
+					}
+					lock.Unlock()
+					continue
+				}
+				a.TXCount = summary.TXHistory.TXCount
+				a.BalanceSat = summary.TXHistory.BalanceSat
+				a.LastChecked = time.Now()
+				if ctx.Err() != nil {
+					continue
+				}
+				if tx := w.SaveDerivedAddress(*a); tx.Error != nil {
+					log.Errorf("unable to save derived address %s: %v", a.Address, tx.Error)
+				}
+				if a.TXCount > 0 {
+					lock.Lock()
+					used = append(used, summary)
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+
+queue:
+	for _, a := range addresses {
+		select {
+		case <-ctx.Done():
+			break queue
+		case jobs <- a:
+		}
+	}
+	close(jobs)
+	// Let the requests that already started finish
+	workers.Wait()
+	if err := ctx.Err(); err != nil {
+		return used, err
+	}
+	return used, failed
+}
+
+// GetDerivedAddresses returns the saved addresses of a chain
+// of a pubkey, ordered by index
+func (w Watcher) GetDerivedAddresses(identifier string, pubkey string, chain int) []DerivedAddress {
+	addresses := []DerivedAddress{}
+	w.DB.Model(&DerivedAddress{}).
+		Where("identifier = ? AND pubkey = ? AND chain = ?", identifier, pubkey, chain).
+		Order("address_index").
+		Find(&addresses)
+	return addresses
+}
+
+// SaveDerivedAddress saves the results of checking a derived address
+func (w Watcher) SaveDerivedAddress(a DerivedAddress) *gorm.DB {
+	// Chain and Index are usually 0, so the key can't be
+	// taken from the struct
+	return w.DB.Model(&DerivedAddress{}).
+		Where("identifier = ? AND pubkey = ? AND chain = ? AND address_index = ?",
+			a.Identifier, a.Pubkey, a.Chain, a.Index).
+		Updates(map[string]interface{}{
+			"tx_count":     a.TXCount,
+			"balance_sat":  a.BalanceSat,
+			"last_checked": a.LastChecked,
+		})
+}
+
+// DeriveAddressPage derives and saves PAGE_SIZE addresses of a
+// chain of a pubkey, starting at index offset
+func (w Watcher) DeriveAddressPage(identifier string, pubkey string, chain int, offset int) ([]DerivedAddress, error) {
+	details, err := w.ExtendedPublicKeyDetailsPage(pubkey, w.PageSize, offset)
+	if err != nil {
+		return nil, err
+	}
+	derived := details.ReceiveAddresses
+	if chain == ChainChange {
+		derived = details.ChangeAddresses
+	}
+
+	addresses := []DerivedAddress{}
+	for i, address := range derived {
+		addresses = append(addresses, DerivedAddress{
+			Identifier: identifier,
+			Pubkey:     pubkey,
+			Chain:      chain,
+			Index:      offset + i,
+			Address:    address,
+		})
+	}
+	if len(addresses) > 0 {
+		if tx := w.DB.CreateInBatches(&addresses, 100); tx.Error != nil {
+			return nil, tx.Error
+		}
+	}
+	return addresses, nil
+}
+
+// DeleteDerivedAddresses deletes all derived addresses for an identifier
+func (w Watcher) DeleteDerivedAddresses(identifier string) {
+	w.DB.Where(&DerivedAddress{Identifier: identifier}).Delete(&DerivedAddress{})
+}
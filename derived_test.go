@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testBIP84Zpub = "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+
+func TestScanPubkeySavedAddressesWithGap(t *testing.T) {
+	k, err := ParseExtendedKey(testBIP84Zpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive, err := k.DeriveAddresses(uint32(ChainReceive), 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Receive addresses 3 and 5 are used
+	used := map[string]bool{receive[3]: true, receive[5]: true}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		txCount := 0
+		if used[strings.TrimPrefix(r.URL.Path, "/api/address/")] {
+			txCount = 1
+		}
+		fmt.Fprintf(w, `{"txHistory":{"txCount":%d,"balanceSat":%d}}`, txCount, txCount*1000)
+	}))
+	defer server.Close()
+
+	w := Watcher{DB: newTestDB(t), Explorer: Explorer{URL: server.URL, Client: server.Client()}}
+	w.Lookahead = 2
+	w.PageSize = 2
+	w.ScanWorkers = 2
+
+	// Only addresses 3 and 4 were saved, with 3 already known to be used
+	for i := 3; i <= 4; i++ {
+		txCount := 0
+		if i == 3 {
+			txCount = 1
+		}
+		w.DB.Create(&DerivedAddress{
+			Identifier: testBIP84Zpub,
+			Pubkey:     testBIP84Zpub,
+			Chain:      ChainReceive,
+			Index:      i,
+			Address:    receive[i],
+			TXCount:    txCount,
+		})
+	}
+
+	scan, err := w.ScanPubkey(context.Background(), testBIP84Zpub, testBIP84Zpub, w.Lookahead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scan.TXCount != 2 || scan.BalanceSat != 2000 || len(scan.UsedSummaries) != 2 {
+		t.Errorf("got %d transactions, %d sats and %d used addresses, want 2, 2000 and 2",
+			scan.TXCount, scan.BalanceSat, len(scan.UsedSummaries))
+	}
+
+	addresses := w.GetDerivedAddresses(testBIP84Zpub, testBIP84Zpub, ChainReceive)
+	for i, a := range addresses {
+		if a.Index != i+3 {
+			t.Fatalf("address %d has index %d, want %d", i, a.Index, i+3)
+		}
+		if a.Address != receive[a.Index] {
+			t.Errorf("address %d is %s, want %s", a.Index, a.Address, receive[a.Index])
+		}
+		// Everything up to LOOKAHEAD after the last used address is checked
+		if a.Index <= 7 && a.LastChecked.IsZero() {
+			t.Errorf("address %d wasn't checked", a.Index)
+		}
+	}
+}
+
+func TestScanPubkeyMempoolLookahead(t *testing.T) {
+	k, err := ParseExtendedKey(testBIP84Zpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive, err := k.DeriveAddresses(uint32(ChainReceive), 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change, err := k.DeriveAddresses(uint32(ChainChange), 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requested := make(chan string, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		address := strings.TrimPrefix(r.URL.Path, "/api/address/")
+		requested <- address
+		txCount := 0
+		if address == receive[1] {
+			txCount = 1
+		}
+		fmt.Fprintf(w, `{"txHistory":{"txCount":%d,"balanceSat":%d}}`, txCount, txCount*1000)
+	}))
+	defer server.Close()
+
+	w := Watcher{DB: newTestDB(t), Explorer: Explorer{URL: server.URL, Client: server.Client()}}
+	w.Lookahead = 5
+	w.PageSize = 5
+	w.ScanWorkers = 1
+
+	// Receive address 1 is used, and the full lookahead after it was saved
+	for i := 0; i <= 6; i++ {
+		txCount := 0
+		if i == 1 {
+			txCount = 1
+		}
+		w.DB.Create(&DerivedAddress{
+			Identifier: testBIP84Zpub,
+			Pubkey:     testBIP84Zpub,
+			Chain:      ChainReceive,
+			Index:      i,
+			Address:    receive[i],
+			TXCount:    txCount,
+		})
+	}
+
+	if _, err := w.ScanPubkey(context.Background(), testBIP84Zpub, testBIP84Zpub, MempoolLookahead); err != nil {
+		t.Fatal(err)
+	}
+	close(requested)
+	got := map[string]bool{}
+	for address := range requested {
+		got[address] = true
+	}
+	want := []string{receive[1], receive[2], change[0]}
+	if len(got) != len(want) {
+		t.Errorf("checked %d addresses, want %d", len(got), len(want))
+	}
+	for _, address := range want {
+		if !got[address] {
+			t.Errorf("%s wasn't checked", address)
+		}
+	}
+}
+
+func TestScanPubkeyLookupError(t *testing.T) {
+	k, err := ParseExtendedKey(testBIP84Zpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive, err := k.DeriveAddresses(uint32(ChainReceive), 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Receive address 2 can't be looked up, so whether the addresses
+	// after it need checking is unknown
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, "/api/address/") == receive[2] {
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":"Too many requests"}`)
+			return
+		}
+		fmt.Fprint(w, `{"txHistory":{"txCount":0,"balanceSat":0}}`)
+	}))
+	defer server.Close()
+
+	w := Watcher{DB: newTestDB(t), Explorer: Explorer{URL: server.URL, Client: server.Client()}}
+	w.Lookahead = 5
+	w.PageSize = 5
+	w.ScanWorkers = 2
+
+	if _, err := w.ScanPubkey(context.Background(), testBIP84Zpub, testBIP84Zpub, w.Lookahead); err == nil {
+		t.Error("scan with an address that couldn't be checked didn't fail")
+	}
+}
@@ -0,0 +1,525 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tyzbit/btcapi"
+)
+
+const (
+	DescriptorPKH         string = "pkh"
+	DescriptorWPKH        string = "wpkh"
+	DescriptorSH          string = "sh"
+	DescriptorWSH         string = "wsh"
+	DescriptorTR          string = "tr"
+	DescriptorMulti       string = "multi"
+	DescriptorSortedMulti string = "sortedmulti"
+
+	// descriptorInputCharset and descriptorChecksumCharset are used
+	// to compute descriptor checksums (BIP380)
+	descriptorInputCharset    = "0123456789()[],'/*abcdefgh@:$%{}IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+	descriptorChecksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	// maxMultisigKeys is the most keys a multi() or sortedmulti() can have
+	maxMultisigKeys int = 20
+)
+
+// descriptorFunctions are the script expressions a descriptor can
+// contain, and the expressions each one may be nested inside of
+// ("" is the top level)
+var descriptorFunctions = map[string][]string{
+	DescriptorPKH:         {"", DescriptorSH, DescriptorWSH},
+	DescriptorWPKH:        {"", DescriptorSH},
+	DescriptorSH:          {""},
+	DescriptorWSH:         {"", DescriptorSH},
+	DescriptorTR:          {""},
+	DescriptorMulti:       {DescriptorSH, DescriptorWSH},
+	DescriptorSortedMulti: {DescriptorSH, DescriptorWSH},
+}
+
+// Descriptor is an output descriptor (BIP380) that
+// describes the addresses of a wallet
+type Descriptor struct {
+	root descriptorNode
+	// Ranged is set if the descriptor derives more than one
+	// address per chain (its keys end in /*)
+	Ranged bool
+	// Chains is how many chains (receive, change) the descriptor has
+	Chains int
+}
+
+// descriptorNode is a script expression of a descriptor, such as wsh(...)
+type descriptorNode struct {
+	Function  string
+	Threshold int
+	Keys      []descriptorKey
+	Inner     *descriptorNode
+}
+
+// descriptorKey is a key expression of a descriptor
+type descriptorKey struct {
+	// Extended is set for extended keys, PublicKey for hex keys
+	Extended  *ExtendedKey
+	PublicKey Point
+	// Path holds the derivation steps after an extended key. A step has
+	// more than one index when it uses multipath derivation (<0;1>).
+	Path     [][]uint32
+	Wildcard bool
+}
+
+// IsDescriptor returns boolean if the string passed looks like
+// an output descriptor
+func IsDescriptor(i string) bool {
+	for function := range descriptorFunctions {
+		if strings.HasPrefix(i, function+"(") {
+			return true
+		}
+	}
+	return false
+}
+
+// DescriptorChecksum returns the checksum of a descriptor (BIP380)
+func DescriptorChecksum(s string) (string, error) {
+	symbols, groups := []uint64{}, []uint64{}
+	for i, c := range s {
+		v := strings.IndexRune(descriptorInputCharset, c)
+		if v < 0 {
+			return "", fmt.Errorf("invalid character %q at position %d", c, i)
+		}
+		symbols = append(symbols, uint64(v&31))
+		groups = append(groups, uint64(v>>5))
+		if len(groups) == 3 {
+			symbols = append(symbols, groups[0]*9+groups[1]*3+groups[2])
+			groups = groups[:0]
+		}
+	}
+	switch len(groups) {
+	case 1:
+		symbols = append(symbols, groups[0])
+	case 2:
+		symbols = append(symbols, groups[0]*3+groups[1])
+	}
+	symbols = append(symbols, 0, 0, 0, 0, 0, 0, 0, 0)
+
+	generator := []uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd}
+	chk := uint64(1)
+	for _, v := range symbols {
+		top := chk >> 35
+		chk = (chk&0x7ffffffff)<<5 ^ v
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	chk ^= 1
+
+	checksum := make([]byte, 8)
+	for i := range checksum {
+		checksum[i] = descriptorChecksumCharset[(chk>>(5*(7-i)))&31]
+	}
+	return string(checksum), nil
+}
+
+// ParseDescriptor parses an output descriptor, verifying its checksum
+// if it has one. Only descriptors with multipath keys (<0;1>) have
+// change addresses, the others derive a single chain as written.
+func ParseDescriptor(s string) (Descriptor, error) {
+	body, checksum, found := strings.Cut(s, "#")
+	expected, err := DescriptorChecksum(body)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if found && checksum != expected {
+		return Descriptor{}, fmt.Errorf("invalid descriptor checksum %q, expected %q", checksum, expected)
+	}
+
+	root, err := parseDescriptorNode(body, "")
+	if err != nil {
+		return Descriptor{}, err
+	}
+	d := Descriptor{root: root, Chains: 1}
+	keys := root.allKeys()
+	multipath := false
+	for _, k := range keys {
+		d.Ranged = d.Ranged || k.Wildcard
+		for _, step := range k.Path {
+			if len(step) == 1 {
+				continue
+			}
+			if multipath && len(step) != d.Chains {
+				return Descriptor{}, errors.New("every multipath key must have the same number of paths")
+			}
+			multipath = true
+			d.Chains = len(step)
+		}
+	}
+
+	// Every chain is scanned as receive or change addresses
+	if d.Chains > 2 {
+		return Descriptor{}, fmt.Errorf("multipath steps can have at most 2 paths (receive and change), not %d", d.Chains)
+	}
+	return d, nil
+}
+
+// parseDescriptorNode parses a script expression nested inside
+// of the parent function
+func parseDescriptorNode(s string, parent string) (descriptorNode, error) {
+	open := strings.IndexByte(s, '(')
+	if open < 0 || !strings.HasSuffix(s, ")") {
+		return descriptorNode{}, fmt.Errorf("invalid script expression %q", s)
+	}
+	n := descriptorNode{Function: s[:open]}
+	args := s[open+1 : len(s)-1]
+
+	parents, ok := descriptorFunctions[n.Function]
+	if !ok {
+		return descriptorNode{}, fmt.Errorf("unsupported script expression %s()", n.Function)
+	}
+	allowed := false
+	for _, p := range parents {
+		allowed = allowed || p == parent
+	}
+	if !allowed {
+		if parent == "" {
+			return descriptorNode{}, fmt.Errorf("%s() can't be used at the top level", n.Function)
+		}
+		return descriptorNode{}, fmt.Errorf("%s() can't be used inside %s()", n.Function, parent)
+	}
+
+	switch n.Function {
+	case DescriptorSH, DescriptorWSH:
+		inner, err := parseDescriptorNode(args, n.Function)
+		if err != nil {
+			return descriptorNode{}, err
+		}
+		n.Inner = &inner
+	case DescriptorMulti, DescriptorSortedMulti:
+		parts := strings.Split(args, ",")
+		threshold, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return descriptorNode{}, fmt.Errorf("invalid %s() threshold %q", n.Function, parts[0])
+		}
+		n.Threshold = threshold
+		for _, part := range parts[1:] {
+			k, err := parseDescriptorKey(part, false)
+			if err != nil {
+				return descriptorNode{}, err
+			}
+			n.Keys = append(n.Keys, k)
+		}
+		if len(n.Keys) == 0 || len(n.Keys) > maxMultisigKeys {
+			return descriptorNode{}, fmt.Errorf("%s() must have between 1 and %d keys", n.Function, maxMultisigKeys)
+		}
+		if n.Threshold < 1 || n.Threshold > len(n.Keys) {
+			return descriptorNode{}, fmt.Errorf("%s() threshold must be between 1 and %d", n.Function, len(n.Keys))
+		}
+	case DescriptorTR:
+		if strings.Contains(args, ",") {
+			return descriptorNode{}, errors.New("tr() script trees aren't supported, only the key path")
+		}
+		fallthrough
+	default:
+		k, err := parseDescriptorKey(args, n.Function == DescriptorTR)
+		if err != nil {
+			return descriptorNode{}, err
+		}
+		n.Keys = []descriptorKey{k}
+	}
+	return n, nil
+}
+
+// parseDescriptorKey parses a key expression. Hex keys are 32 byte
+// x-only keys in tr() and 33 byte compressed keys everywhere else.
+func parseDescriptorKey(s string, xOnly bool) (descriptorKey, error) {
+	// The key origin ([fingerprint/path]) doesn't change the addresses
+	if strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return descriptorKey{}, fmt.Errorf("key origin of %q is missing a ]", s)
+		}
+		s = s[end+1:]
+	}
+	parts := strings.Split(s, "/")
+	k := descriptorKey{}
+
+	if b, err := hex.DecodeString(parts[0]); err == nil {
+		if len(parts) > 1 {
+			return descriptorKey{}, fmt.Errorf("hex key %s can't be derived", parts[0])
+		}
+		if xOnly && len(b) == 32 {
+			y, err := liftX(new(big.Int).SetBytes(b))
+			if err != nil {
+				return descriptorKey{}, err
+			}
+			k.PublicKey = Point{new(big.Int).SetBytes(b), y}
+			return k, nil
+		}
+		if k.PublicKey, err = ParseCompressedPoint(b); err != nil {
+			return descriptorKey{}, fmt.Errorf("invalid hex key %s: %w", parts[0], err)
+		}
+		return k, nil
+	}
+
+	extended, err := ParseExtendedKey(parts[0])
+	if err != nil {
+		return descriptorKey{}, fmt.Errorf("invalid key %s: %w", parts[0], err)
+	}
+	k.Extended = &extended
+	for i, part := range parts[1:] {
+		if part == "*" && i == len(parts)-2 {
+			k.Wildcard = true
+			continue
+		}
+		step := []uint32{}
+		indexes := []string{part}
+		if strings.HasPrefix(part, "<") && strings.HasSuffix(part, ">") {
+			indexes = strings.Split(part[1:len(part)-1], ";")
+			if len(indexes) < 2 {
+				return descriptorKey{}, fmt.Errorf("multipath step %s must have at least 2 paths", part)
+			}
+		}
+		for _, index := range indexes {
+			if strings.HasSuffix(index, "'") || strings.HasSuffix(index, "h") {
+				return descriptorKey{}, fmt.Errorf("hardened step %s can't be derived from a public key", index)
+			}
+			i, err := strconv.ParseUint(index, 10, 32)
+			if err != nil || uint32(i) >= HardenedKeyStart {
+				return descriptorKey{}, fmt.Errorf("invalid derivation step %s", index)
+			}
+			step = append(step, uint32(i))
+		}
+		k.Path = append(k.Path, step)
+	}
+	multipath := 0
+	for _, step := range k.Path {
+		if len(step) > 1 {
+			multipath++
+		}
+	}
+	if multipath > 1 {
+		return descriptorKey{}, fmt.Errorf("key %s has more than one multipath step", parts[0])
+	}
+	return k, nil
+}
+
+// allKeys returns the keys of a node and the nodes inside it
+func (n descriptorNode) allKeys() []descriptorKey {
+	if n.Inner != nil {
+		return n.Inner.allKeys()
+	}
+	return n.Keys
+}
+
+// Type returns the script expressions of the descriptor, like wsh(sortedmulti)
+func (d Descriptor) Type() string {
+	t := ""
+	for n := &d.root; n != nil; n = n.Inner {
+		t += n.Function + "("
+	}
+	return strings.TrimSuffix(t, "(") + strings.Repeat(")", strings.Count(t, "(")-1)
+}
+
+// Address returns the address at index of a chain (0 for
+// receive, 1 for change) of the descriptor
+func (d Descriptor) Address(chain int, index uint32) (string, error) {
+	if chain >= d.Chains {
+		return "", fmt.Errorf("descriptor has no chain %d", chain)
+	}
+	return d.root.address(chain, index)
+}
+
+// DeriveAddresses returns the addresses of a chain of the descriptor,
+// starting at index offset. Descriptors that aren't ranged only
+// have one address.
+func (d Descriptor) DeriveAddresses(chain int, offset int, limit int) ([]string, error) {
+	addresses := []string{}
+	if chain >= d.Chains {
+		return addresses, nil
+	}
+	if !d.Ranged {
+		limit = 1 - offset
+	}
+	for i := offset; i < offset+limit; i++ {
+		address, err := d.Address(chain, uint32(i))
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+// derive returns the public key at index of a chain
+func (k descriptorKey) derive(chain int, index uint32) (Point, error) {
+	if k.Extended == nil {
+		return k.PublicKey, nil
+	}
+	var err error
+	key := *k.Extended
+	for _, step := range k.Path {
+		i := step[0]
+		if len(step) > 1 {
+			i = step[chain]
+		}
+		if key, err = key.Child(i); err != nil {
+			return Point{}, err
+		}
+	}
+	if k.Wildcard {
+		if key, err = key.Child(index); err != nil {
+			return Point{}, err
+		}
+	}
+	return key.PublicKey, nil
+}
+
+// publicKeys returns the compressed public keys of the node
+// at index of a chain, sorted for sortedmulti()
+func (n descriptorNode) publicKeys(chain int, index uint32) ([][]byte, error) {
+	keys := [][]byte{}
+	for _, k := range n.Keys {
+		p, err := k.derive(chain, index)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, p.SerializeCompressed())
+	}
+	if n.Function == DescriptorSortedMulti {
+		sort.Slice(keys, func(i, j int) bool {
+			return bytes.Compare(keys[i], keys[j]) < 0
+		})
+	}
+	return keys, nil
+}
+
+// script returns the script of a node nested in sh() or wsh()
+func (n descriptorNode) script(chain int, index uint32) ([]byte, error) {
+	if n.Inner != nil {
+		inner, err := n.Inner.script(chain, index)
+		if err != nil {
+			return nil, err
+		}
+		// Only wsh() can be nested
+		program := sha256.Sum256(inner)
+		return append([]byte{0x00, 0x20}, program[:]...), nil
+	}
+	keys, err := n.publicKeys(chain, index)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Function {
+	case DescriptorPKH:
+		script := append([]byte{0x76, 0xa9, 0x14}, hash160(keys[0])...)
+		return append(script, 0x88, 0xac), nil
+	case DescriptorWPKH:
+		return append([]byte{0x00, 0x14}, hash160(keys[0])...), nil
+	}
+	// multi() and sortedmulti()
+	script := pushNumber(n.Threshold)
+	for _, k := range keys {
+		script = append(script, byte(len(k)))
+		script = append(script, k...)
+	}
+	script = append(script, pushNumber(len(keys))...)
+	return append(script, 0xae), nil
+}
+
+// address returns the address of a top level node
+func (n descriptorNode) address(chain int, index uint32) (string, error) {
+	if n.Inner != nil {
+		inner, err := n.Inner.script(chain, index)
+		if err != nil {
+			return "", err
+		}
+		if n.Function == DescriptorSH {
+			return p2shAddress(hash160(inner)), nil
+		}
+		program := sha256.Sum256(inner)
+		return witnessAddress(0, program[:])
+	}
+	keys, err := n.publicKeys(chain, index)
+	if err != nil {
+		return "", err
+	}
+	switch n.Function {
+	case DescriptorPKH:
+		return p2pkhAddress(hash160(keys[0])), nil
+	case DescriptorWPKH:
+		return witnessAddress(0, hash160(keys[0]))
+	}
+	// tr()
+	p, err := n.Keys[0].derive(chain, index)
+	if err != nil {
+		return "", err
+	}
+	output, err := taprootOutputKey(p)
+	if err != nil {
+		return "", err
+	}
+	return witnessAddress(1, output.X.FillBytes(make([]byte, 32)))
+}
+
+// pushNumber returns the script that pushes a multisig key count
+func pushNumber(n int) []byte {
+	if n <= 16 {
+		// OP_1 through OP_16
+		return []byte{0x50 + byte(n)}
+	}
+	return []byte{0x01, byte(n)}
+}
+
+// taggedHash returns the BIP340 tagged hash of data
+func taggedHash(tag string, data []byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// taprootOutputKey tweaks an internal key without a script tree
+// into the output key of a taproot address (BIP341, BIP86)
+func taprootOutputKey(internal Point) (Point, error) {
+	x := internal.X.FillBytes(make([]byte, 32))
+	y, err := liftX(internal.X)
+	if err != nil {
+		return Point{}, err
+	}
+	t := new(big.Int).SetBytes(taggedHash("TapTweak", x))
+	if t.Cmp(secp256k1.N) >= 0 {
+		return Point{}, errors.New("invalid taproot tweak")
+	}
+	output := Point{internal.X, y}.Add(ScalarBaseMult(t))
+	if output.IsInfinity() {
+		return Point{}, errors.New("invalid taproot output key")
+	}
+	return output, nil
+}
+
+// DescriptorDetailsPage derives the receive and change addresses of
+// a descriptor, returning them like ExtendedPublicKeyDetailsPage
+func DescriptorDetailsPage(descriptor string, limit int, offset int) (details btcapi.ExtendedPublicKeyDetails, err error) {
+	d, err := ParseDescriptor(descriptor)
+	if err != nil {
+		return details, fmt.Errorf("invalid descriptor: %w", err)
+	}
+	details.KeyType = KindDescriptor
+	details.OutputType = d.Type()
+	details.OutputTypeDesc = "Output descriptor " + d.Type()
+	if details.ReceiveAddresses, err = d.DeriveAddresses(0, offset, limit); err != nil {
+		return details, fmt.Errorf("unable to derive receive addresses: %w", err)
+	}
+	if details.ChangeAddresses, err = d.DeriveAddresses(1, offset, limit); err != nil {
+		return details, fmt.Errorf("unable to derive change addresses: %w", err)
+	}
+	return details, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	// testBIP84Account and testBIP86Account are the account keys of
+	// the BIP84 and BIP86 test vectors, as xpubs
+	testBIP84Account = "xpub6CatWdiZiodmUeTDp8LT5or8nmbKNcuyvz7WyksVFkKB4RHwCD3XyuvPEbvqAQY3rAPshWcMLoP2fMFMKHPJ4ZeZXYVUhLv1VMrjPC7PW6V"
+	testBIP86Account = "xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ"
+)
+
+func TestDescriptorChecksum(t *testing.T) {
+	// From BIP380
+	got, err := DescriptorChecksum("raw(deadbeef)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "89f8spxm" {
+		t.Errorf("got %s, want 89f8spxm", got)
+	}
+	if _, err := DescriptorChecksum("raw(deadbeef)\n"); err == nil {
+		t.Error("computed the checksum of an invalid character")
+	}
+}
+
+func TestParseDescriptorChecksum(t *testing.T) {
+	body := "wpkh([73c5da0a/84'/0'/0']" + testBIP84Account + "/0/*)"
+	checksum, err := DescriptorChecksum(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseDescriptor(body + "#" + checksum); err != nil {
+		t.Errorf("valid checksum rejected: %v", err)
+	}
+	if _, err := ParseDescriptor(body); err != nil {
+		t.Errorf("descriptor without a checksum rejected: %v", err)
+	}
+
+	// Change the last character of the checksum
+	bad := []byte(checksum)
+	bad[len(bad)-1] = descriptorChecksumCharset[(strings.IndexByte(descriptorChecksumCharset, bad[len(bad)-1])+1)%32]
+	if _, err := ParseDescriptor(body + "#" + string(bad)); err == nil {
+		t.Error("invalid checksum accepted")
+	}
+	if _, err := ParseDescriptor(body + "#"); err == nil {
+		t.Error("empty checksum accepted")
+	}
+}
+
+func TestDescriptorAddresses(t *testing.T) {
+	tests := []struct {
+		name       string
+		descriptor string
+		chains     int
+		// receive and change are the first addresses of each chain
+		receive []string
+		change  []string
+	}{
+		{
+			name:       "receive chain only",
+			descriptor: "wpkh(" + testBIP84Account + "/0/*)",
+			chains:     1,
+			receive:    []string{"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"},
+		},
+		{
+			name:       "multipath",
+			descriptor: "wpkh([73c5da0a/84h/0h/0h]" + testBIP84Account + "/<0;1>/*)",
+			chains:     2,
+			receive:    []string{"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"},
+			change:     []string{"bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"},
+		},
+		{
+			name:       "change chain only",
+			descriptor: "wpkh(" + testBIP84Account + "/1/*)",
+			chains:     1,
+			receive:    []string{"bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"},
+		},
+		{
+			name:       "other chain",
+			descriptor: "wpkh(" + testBIP84Account + "/5/*)",
+			chains:     1,
+			receive:    []string{"bc1quqqk858dtu5rreqwvfgsuw2urjyuz9yq27nz27"},
+		},
+		{
+			name:       "taproot",
+			descriptor: "tr(" + testBIP86Account + "/0/*)",
+			chains:     1,
+			receive:    []string{"bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"},
+		},
+		{
+			name:       "not ranged",
+			descriptor: "wpkh(" + testBIP84Account + "/0/0)",
+			chains:     1,
+			receive:    []string{"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, err := ParseDescriptor(test.descriptor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.Chains != test.chains {
+				t.Errorf("%d chains, want %d", d.Chains, test.chains)
+			}
+			// Only multipath descriptors have change addresses
+			if change, err := d.DeriveAddresses(1, 0, 1); err != nil || len(change) != len(test.change) {
+				t.Errorf("got change addresses %v (%v), want %d", change, err, len(test.change))
+			}
+			for chain, want := range [][]string{test.receive, test.change} {
+				if len(want) == 0 {
+					continue
+				}
+				addresses, err := d.DeriveAddresses(chain, 0, len(want))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(addresses) != len(want) {
+					t.Fatalf("chain %d has %d addresses, want %d", chain, len(addresses), len(want))
+				}
+				for i := range want {
+					if addresses[i] != want[i] {
+						t.Errorf("chain %d address %d is %s, want %s", chain, i, addresses[i], want[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseDescriptorInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		descriptor string
+	}{
+		{"mismatched multipath", "wsh(multi(1," + testBIP84Account + "/<0;1>/*," + testBIP86Account + "/<0;1;2>/*))"},
+		{"more than 2 paths", "wpkh(" + testBIP84Account + "/<0;1;2>/*)"},
+		{"multipath with one path", "wpkh(" + testBIP84Account + "/<0>/*)"},
+		{"two multipath steps", "wpkh(" + testBIP84Account + "/<0;1>/<0;1>/*)"},
+		{"hardened step", "wpkh(" + testBIP84Account + "/0h/*)"},
+		{"unsupported function", "raw(deadbeef)"},
+		{"nested at the wrong level", "wpkh(wpkh(" + testBIP84Account + "/0/*))"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParseDescriptor(test.descriptor); err == nil {
+				t.Error("parsed an invalid descriptor")
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	NotifierDiscord string = "discord"
+
+	// DiscordHereMention notifies everyone online in the channel
+	DiscordHereMention string = "@here"
+)
+
+// DiscordPayload is the body sent to a Discord webhook
+type DiscordPayload struct {
+	Content string `json:"content"`
+}
+
+// DiscordNotifier sends notifications to a Discord webhook.
+// DiscordNotifier implements the Notifier interface
+type DiscordNotifier struct {
+	Webhook string
+}
+
+// NewDiscordNotifier creates a DiscordNotifier from the configuration
+func NewDiscordNotifier(c Config) (Notifier, error) {
+	if c.DiscordWebhook == "" {
+		return nil, errors.New("DISCORD_WEBHOOK is not set")
+	}
+	return DiscordNotifier{Webhook: c.DiscordWebhook}, nil
+}
+
+// Name returns the name of the notifier
+func (d DiscordNotifier) Name() string {
+	return NotifierDiscord
+}
+
+// Notify sends the rendered message for a BalanceEvent to Discord
+func (d DiscordNotifier) Notify(ctx context.Context, e BalanceEvent) error {
+	message, err := e.Message()
+	if err != nil {
+		return err
+	}
+	// Mention the channel so high priority alerts aren't missed
+	if e.Priority == PriorityHigh {
+		message = DiscordHereMention + "\n" + message
+	}
+
+	resp, err := postJSON(ctx, d.Webhook, DiscordPayload{Content: message})
+	if err != nil {
+		return fmt.Errorf("error calling Discord API: %w", err)
+	}
+	defer resp.Body.Close()
+	// Discord answers a successful webhook call with No Content
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("error calling Discord API: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const DefaultDustThreshold int = 1000
+
+// DustOutput is an output below DUST_THRESHOLD that was sent to a
+// watched identifier (address or pubkey) by a transaction the
+// identifier didn't fund. Unspent dust is left out of the spendable
+// balance, since spending it links the addresses it was sent to.
+type DustOutput struct {
+	Identifier string    `gorm:"primaryKey" json:"identifier"`
+	TXID       string    `gorm:"primaryKey;column:txid" json:"txid"`
+	VOut       int       `gorm:"primaryKey;column:vout;autoIncrement:false" json:"vout"`
+	Address    string    `json:"address"`
+	ValueSat   int       `json:"valueSat"`
+	Spent      bool      `json:"spent"`
+	FirstSeen  time.Time `json:"firstSeen"`
+}
+
+// IsDust returns whether an output of valueSat sent to a watch by
+// someone else is dust. A negative DUST_THRESHOLD disables dust
+// detection, since no output is below it.
+func (w Watcher) IsDust(valueSat int) bool {
+	return w.DustThreshold >= 0 && valueSat < w.DustThreshold
+}
+
+// Outpoint identifies the output of a transaction
+type Outpoint struct {
+	TXID string
+	VOut int
+}
+
+// SaveDustOutputs labels outputs as dust
+func (w Watcher) SaveDustOutputs(outputs []DustOutput) {
+	for _, o := range outputs {
+		if tx := w.DB.Save(&o); tx.Error != nil {
+			log.Errorf("unable to save dust output %s:%d for %s: %v", o.TXID, o.VOut, o.Identifier, tx.Error)
+		}
+	}
+}
+
+// MarkDustSpent marks the dust outputs of an identifier spent
+// by a transaction as no longer part of the balance
+func (w Watcher) MarkDustSpent(identifier string, outpoints []Outpoint) {
+	for _, o := range outpoints {
+		tx := w.DB.Model(&DustOutput{}).
+			Where("identifier = ? AND txid = ? AND vout = ?", identifier, o.TXID, o.VOut).
+			Update("spent", true)
+		if tx.Error != nil {
+			log.Errorf("unable to update dust output %s:%d for %s: %v", o.TXID, o.VOut, identifier, tx.Error)
+		} else if tx.RowsAffected > 0 {
+			log.Warnf("dust output %s:%d for %s was spent", o.TXID, o.VOut, identifier)
+		}
+	}
+}
+
+// DustBalance returns the value of the unspent dust of an identifier
+func (w Watcher) DustBalance(identifier string) int {
+	var balance int
+	w.DB.Model(&DustOutput{}).
+		Where("identifier = ? AND spent = ?", identifier, false).
+		Select("COALESCE(SUM(value_sat), 0)").
+		Scan(&balance)
+	return balance
+}
+
+// DustTransactions returns the transactions that only sent dust
+func DustTransactions(transactions []WatchedTransaction) []WatchedTransaction {
+	dust := []WatchedTransaction{}
+	for _, t := range transactions {
+		if t.Dust {
+			dust = append(dust, t)
+		}
+	}
+	return dust
+}
+
+// DeleteTransactionDust deletes the dust outputs of a single transaction
+func (w Watcher) DeleteTransactionDust(identifier string, txid string) {
+	w.DB.Where(&DustOutput{Identifier: identifier, TXID: txid}).Delete(&DustOutput{})
+}
+
+// DeleteDustOutputs deletes all dust outputs for an identifier
+func (w Watcher) DeleteDustOutputs(identifier string) {
+	w.DB.Where(&DustOutput{Identifier: identifier}).Delete(&DustOutput{})
+}
+
+// GetDust returns the dust outputs of the identifier in the identifier
+// query parameter, or every dust output if it isn't set
+func (w Watcher) GetDust(c *gin.Context) {
+	outputs := []DustOutput{}
+	tx := w.DB.Model(&DustOutput{})
+	if identifier := c.Query("identifier"); identifier != "" {
+		tx = tx.Where(&DustOutput{Identifier: NormalizeIdentifier(identifier)})
+	}
+	tx.Order("first_seen DESC").Find(&outputs)
+	c.JSON(http.StatusOK, outputs)
+}
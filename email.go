@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	NotifierEmail string = "email"
+
+	SMTPTLSNone     string = "none"
+	SMTPTLSStartTLS string = "starttls"
+	SMTPTLSImplicit string = "tls"
+
+	DefaultSMTPPort int = 587
+)
+
+const (
+	emailHTMLTemplate = `<html>
+<body>
+<h2>{{ .Title }}</h2>
+<table>
+<tr><td><b>Nickname</b></td><td>{{ .Nickname }}</td></tr>
+<tr><td><b>{{ .KindName }}</b></td><td><code>{{ .Identifier }}</code></td></tr>
+<tr><td><b>Previous Balance (satoshis)</b></td><td>{{ .PreviousBalanceSat }}</td></tr>
+<tr><td><b>Previous Balance ({{ .Currency }})</b></td><td>{{ .PreviousBalanceCurrency }}</td></tr>
+<tr><td><b>Transactions</b></td><td>{{ .TXCount }}</td></tr>
+<tr><td><b>New Balance (satoshis)</b></td><td>{{ .BalanceSat }}</td></tr>
+<tr><td><b>New Balance ({{ .Currency }})</b></td><td>{{ .BalanceCurrency }}</td></tr>
+{{ if .PendingBalanceSat }}<tr><td><b>Confirmed Balance (satoshis)</b></td><td>{{ .ConfirmedBalanceSat }}</td></tr>
+<tr><td><b>Pending Balance (satoshis)</b></td><td>{{ .PendingBalanceSat }}</td></tr>
+{{ end }}{{ if ne .SpendableBalanceSat .BalanceSat }}<tr><td><b>Spendable Balance (satoshis)</b></td><td>{{ .SpendableBalanceSat }}</td></tr>
+{{ end }}{{ range .Transactions }}<tr><td><b>Transaction</b></td><td><code>{{ .TXID }}</code><br>{{ .Direction }} {{ .NetSat }} sats, fee {{ .FeeSat }} sats, {{ .Status }}</td></tr>
+{{ end }}</table>
+</body>
+</html>
+`
+)
+
+// plainTextEscaper removes the bold markers of message templates
+// for the plain text body, leaving the values as they are
+var plainTextEscaper = Escaper{
+	Text:  func(text string) string { return strings.ReplaceAll(text, "**", "") },
+	Value: func(value string) string { return value },
+}
+
+// EmailNotifier sends notifications as multipart emails over SMTP.
+// EmailNotifier implements the Notifier interface
+type EmailNotifier struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	TLSMode  string
+	From     string
+	To       []string
+}
+
+// NewEmailNotifier creates an EmailNotifier from the configuration
+func NewEmailNotifier(c Config) (Notifier, error) {
+	e := EmailNotifier{
+		Host:     c.SMTPHost,
+		Port:     c.SMTPPort,
+		Username: c.SMTPUsername,
+		Password: c.SMTPPassword,
+		TLSMode:  strings.ToLower(c.SMTPTLS),
+		From:     c.SMTPFrom,
+	}
+	for _, to := range strings.Split(c.SMTPTo, ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			e.To = append(e.To, to)
+		}
+	}
+
+	if e.Host == "" {
+		return nil, errors.New("SMTP_HOST is not set")
+	}
+	if e.From == "" {
+		return nil, errors.New("SMTP_FROM is not set")
+	}
+	if len(e.To) == 0 {
+		return nil, errors.New("SMTP_TO is not set")
+	}
+	if e.Port == 0 {
+		e.Port = DefaultSMTPPort
+	}
+	switch e.TLSMode {
+	case "":
+		e.TLSMode = SMTPTLSStartTLS
+	case SMTPTLSNone, SMTPTLSStartTLS, SMTPTLSImplicit:
+	default:
+		return nil, fmt.Errorf("unknown SMTP_TLS mode \"%s\"", e.TLSMode)
+	}
+	return e, nil
+}
+
+// Name returns the name of the notifier
+func (e EmailNotifier) Name() string {
+	return NotifierEmail
+}
+
+// Notify emails a BalanceEvent to every recipient
+func (e EmailNotifier) Notify(ctx context.Context, be BalanceEvent) error {
+	message, err := e.Message(be)
+	if err != nil {
+		return err
+	}
+
+	client, err := e.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("error connecting to SMTP server: %w", err)
+	}
+	defer client.Close()
+
+	if e.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.Username, e.Password, e.Host)); err != nil {
+			return fmt.Errorf("error authenticating to SMTP server: %w", err)
+		}
+	}
+	if err := client.Mail(e.From); err != nil {
+		return fmt.Errorf("error setting sender: %w", err)
+	}
+	for _, to := range e.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("error adding recipient %s: %w", to, err)
+		}
+	}
+	wc, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error starting message: %w", err)
+	}
+	if _, err := wc.Write(message); err != nil {
+		return fmt.Errorf("error writing message: %w", err)
+	}
+	if err := wc.Close(); err != nil {
+		return fmt.Errorf("error sending message: %w", err)
+	}
+	return client.Quit()
+}
+
+// dial connects to the SMTP server using the configured TLS mode
+func (e EmailNotifier) dial(ctx context.Context) (*smtp.Client, error) {
+	addr := net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+	tlsConfig := &tls.Config{ServerName: e.Host}
+	dialer := &net.Dialer{Timeout: NotifierTimeout}
+
+	var conn net.Conn
+	var err error
+	if e.TLSMode == SMTPTLSImplicit {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The deadline covers the whole conversation, so a server
+	// that stops responding doesn't hold up the outbox
+	deadline := time.Now().Add(NotifierTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	client, err := smtp.NewClient(conn, e.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if e.TLSMode == SMTPTLSStartTLS {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// Message builds a multipart/alternative email with plain text
+// and HTML bodies for a BalanceEvent
+func (e EmailNotifier) Message(be BalanceEvent) ([]byte, error) {
+	text, err := be.EscapedMessage(&plainTextEscaper)
+	if err != nil {
+		return nil, err
+	}
+	t, err := template.New("emailHTML").Parse(emailHTMLTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up template: %w", err)
+	}
+	var html bytes.Buffer
+	if err := t.Execute(&html, be); err != nil {
+		return nil, fmt.Errorf("error executing template: %w", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		// Clients prefer the last alternative they can display
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html.String()},
+	}
+	for _, part := range parts {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, fmt.Errorf("error creating message part: %w", err)
+		}
+		if _, err := pw.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("error writing message part: %w", err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("error finishing message: %w", err)
+	}
+
+	var m bytes.Buffer
+	fmt.Fprintf(&m, "From: %s\r\n", e.From)
+	fmt.Fprintf(&m, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&m, "Subject: %s\r\n", EncodeHeader(be.Title()+": "+be.Nickname))
+	fmt.Fprintf(&m, "Date: %s\r\n", be.Time.Format(time.RFC1123Z))
+	if be.Priority == PriorityHigh {
+		fmt.Fprintf(&m, "X-Priority: 1\r\n")
+		fmt.Fprintf(&m, "Importance: high\r\n")
+	}
+	fmt.Fprintf(&m, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&m, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mw.Boundary())
+	m.Write(body.Bytes())
+	return m.Bytes(), nil
+}
+
+// EncodeHeader makes a header value from user-supplied text, removing
+// line breaks so it can't add headers and encoding non-ASCII text
+func EncodeHeader(value string) string {
+	value = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(value)
+	return mime.QEncoding.Encode("utf-8", value)
+}
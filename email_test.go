@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpMessage is a message received by an SMTP sink
+type smtpMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// newSMTPSink accepts SMTP connections on a local port and sends the
+// messages it receives on the returned channel
+func newSMTPSink(t *testing.T) (host string, port int, messages chan smtpMessage) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	messages = make(chan smtpMessage, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, messages
+}
+
+// serveSMTP answers a single SMTP conversation
+func serveSMTP(conn net.Conn, messages chan smtpMessage) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP sink")
+
+	var m smtpMessage
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			m.From = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			m.To = append(m.To, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			m.Data = data.String()
+			messages <- m
+			m = smtpMessage{}
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestEmailNotifierNotify(t *testing.T) {
+	host, port, messages := newSMTPSink(t)
+	notifier, err := NewEmailNotifier(Config{
+		SMTPHost: host,
+		SMTPPort: port,
+		SMTPTLS:  SMTPTLSNone,
+		SMTPFrom: "notifier@example.com",
+		SMTPTo:   "alice@example.com, bob@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := BalanceEvent{
+		Kind:       KindAddress,
+		Identifier: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		Nickname:   "Cold **storage**",
+		BalanceSat: 1234,
+		Time:       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if err := notifier.Notify(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+
+	var m smtpMessage
+	select {
+	case m = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message was received")
+	}
+	if m.From != "notifier@example.com" {
+		t.Errorf("got sender %q, want notifier@example.com", m.From)
+	}
+	if strings.Join(m.To, ",") != "alice@example.com,bob@example.com" {
+		t.Errorf("got recipients %v, want alice@example.com and bob@example.com", m.To)
+	}
+	for _, want := range []string{
+		"Subject: " + EncodeHeader("Address Balance Changed: Cold **storage**") + "\r\n",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Type: text/html; charset=utf-8",
+		"New Balance (satoshis): " + strconv.Itoa(e.BalanceSat),
+		"<h2>Address Balance Changed</h2>",
+	} {
+		if !strings.Contains(m.Data, want) {
+			t.Errorf("message doesn't contain %q:\n%s", want, m.Data)
+		}
+	}
+
+	// The markdown of the template is removed from the plain text body,
+	// but the values are left as they are
+	text := m.Data[strings.Index(m.Data, "text/plain"):strings.Index(m.Data, "text/html")]
+	if !strings.Contains(text, "Address Balance Changed\r\n") || !strings.Contains(text, "Nickname: Cold **storage**") {
+		t.Errorf("plain text body isn't plain:\n%s", text)
+	}
+}
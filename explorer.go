@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tyzbit/btcapi"
+)
+
+const (
+	// ExplorerTimeout limits how long a request to BTC_RPC_API can take
+	ExplorerTimeout time.Duration = 30 * time.Second
+	// ExplorerTxPageSize is how many transactions of an
+	// address are requested at a time
+	ExplorerTxPageSize int = 50
+)
+
+// ErrNotFound is returned by Explorer when the explorer clearly
+// says that what was requested doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// explorerErrorLength limits how much of an error
+// response is included in errors
+const explorerErrorLength = 200
+
+// explorerNotFoundMessages are the errors the explorer passes on from
+// bitcoind when a transaction or block doesn't exist
+var explorerNotFoundMessages = []string{
+	"No such mempool or blockchain transaction",
+	"Block not found",
+	"Block height out of range",
+}
+
+// Explorer calls the API of the BTC-RPC-Explorer at BTC_RPC_API.
+// Unlike btcapi, it checks the status of every response, so an error
+// (like being rate limited) is never mistaken for a result. Every
+// request to the explorer goes through Client, which is where
+// REQUESTS_PER_SECOND is applied (see NewExplorer).
+type Explorer struct {
+	URL    string
+	Client *http.Client
+}
+
+// ExplorerTx is a transaction as returned by the explorer, which
+// is the verbose output of bitcoind's getrawtransaction
+type ExplorerTx struct {
+	TXID string `json:"txid"`
+	VIn  []struct {
+		// TXID and VOut are empty for coinbase inputs
+		TXID string `json:"txid"`
+		VOut int    `json:"vout"`
+	} `json:"vin"`
+	VOut          []ExplorerTxOutput `json:"vout"`
+	BlockHash     string             `json:"blockhash"`
+	Confirmations int                `json:"confirmations"`
+}
+
+// ExplorerTxOutput is an output of an ExplorerTx
+type ExplorerTxOutput struct {
+	// Value is in BTC, see ValueSat
+	Value        float64 `json:"value"`
+	N            int     `json:"n"`
+	ScriptPubKey struct {
+		Hex     string `json:"hex"`
+		Address string `json:"address"`
+	} `json:"scriptPubKey"`
+}
+
+// ValueSat returns the value of the output in satoshis
+func (o ExplorerTxOutput) ValueSat() int {
+	return int(math.Round(o.Value * float64(SatsPerBitcoin)))
+}
+
+// Tx looks up a transaction. It returns an error wrapping
+// ErrNotFound if the explorer doesn't know the transaction.
+func (e Explorer) Tx(ctx context.Context, txid string) (ExplorerTx, error) {
+	var tx ExplorerTx
+	if err := e.getJSON(ctx, "/tx/"+txid, &tx); err != nil {
+		return tx, err
+	}
+	if tx.TXID == "" {
+		return tx, fmt.Errorf("transaction %s: response has no txid", txid)
+	}
+	return tx, nil
+}
+
+// AddressSummary looks up the balance and transactions of an address.
+// The explorer returns the transactions a page at a time, newest first,
+// so every page is requested and combined into the summary.
+func (e Explorer) AddressSummary(ctx context.Context, address string) (btcapi.AddressSummary, error) {
+	var summary btcapi.AddressSummary
+	seen := map[string]bool{}
+	for offset := 0; ; {
+		var page btcapi.AddressSummary
+		route := fmt.Sprintf("/address/%s?limit=%d&offset=%d&sort=desc", address, ExplorerTxPageSize, offset)
+		if err := e.getJSON(ctx, route, &page); err != nil {
+			return summary, err
+		}
+		if offset == 0 {
+			summary = page
+			summary.TXHistory.TXIDs = nil
+			summary.TXHistory.BlockHeightsByTxid = map[string]int{}
+		}
+		// A transaction can show up twice when a new one
+		// shifts the pages while they're requested
+		for _, txid := range page.TXHistory.TXIDs {
+			if !seen[txid] {
+				seen[txid] = true
+				summary.TXHistory.TXIDs = append(summary.TXHistory.TXIDs, txid)
+			}
+		}
+		for txid, height := range page.TXHistory.BlockHeightsByTxid {
+			summary.TXHistory.BlockHeightsByTxid[txid] = height
+		}
+
+		offset = offset + len(page.TXHistory.TXIDs)
+		if len(page.TXHistory.TXIDs) == 0 || offset >= page.TXHistory.TXCount {
+			return summary, nil
+		}
+	}
+}
+
+// TipHash returns the hash of the tip of the chain
+func (e Explorer) TipHash(ctx context.Context) (string, error) {
+	body, err := e.get(ctx, "/blocks/tip/hash")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// TipHeight returns the height of the tip of the chain
+func (e Explorer) TipHeight(ctx context.Context) (int, error) {
+	body, err := e.get(ctx, "/blocks/tip/height")
+	if err != nil {
+		return 0, err
+	}
+	height, err := strconv.Atoi(strings.TrimSpace(string(body)))
+	if err != nil {
+		return 0, fmt.Errorf("/blocks/tip/height: unable to parse response: %w", err)
+	}
+	return height, nil
+}
+
+// Price returns the price of one bitcoin in USD, EUR, GBP and XAU
+func (e Explorer) Price(ctx context.Context) (btcapi.Price, error) {
+	// The prices are strings with thousands separators
+	var response struct {
+		USD string `json:"usd"`
+		EUR string `json:"eur"`
+		GBP string `json:"gbp"`
+		XAU string `json:"xau"`
+	}
+	if err := e.getJSON(ctx, "/price", &response); err != nil {
+		return btcapi.Price{}, err
+	}
+	// Like btcapi, a currency the explorer doesn't have is 0
+	parse := func(s string) float64 {
+		price, _ := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+		return price
+	}
+	return btcapi.Price{
+		USD: parse(response.USD),
+		EUR: parse(response.EUR),
+		GBP: parse(response.GBP),
+		XAU: parse(response.XAU),
+	}, nil
+}
+
+// ExplorerBlock is a block as returned by the explorer
+type ExplorerBlock struct {
+	Hash   string `json:"hash"`
+	Height int    `json:"height"`
+}
+
+// BlockWithHeight looks up the block at a height of the chain
+func (e Explorer) BlockWithHeight(ctx context.Context, height int) (ExplorerBlock, error) {
+	return e.block(ctx, strconv.Itoa(height))
+}
+
+// BlockWithHash looks up a block by its hash
+func (e Explorer) BlockWithHash(ctx context.Context, hash string) (ExplorerBlock, error) {
+	return e.block(ctx, hash)
+}
+
+// block looks up a block by its hash or height
+func (e Explorer) block(ctx context.Context, hashOrHeight string) (ExplorerBlock, error) {
+	var block ExplorerBlock
+	if err := e.getJSON(ctx, "/block/"+hashOrHeight, &block); err != nil {
+		return block, err
+	}
+	if block.Hash == "" {
+		return block, fmt.Errorf("block %s: response has no hash", hashOrHeight)
+	}
+	return block, nil
+}
+
+// getJSON calls a route of the API and decodes the response into v
+func (e Explorer) getJSON(ctx context.Context, route string, v interface{}) error {
+	body, err := e.get(ctx, route)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%s: unable to parse response: %w", route, err)
+	}
+	return nil
+}
+
+// get calls a route of the API and returns the body of the response.
+// Responses that aren't successful or are empty are errors.
+func (e Explorer) get(ctx context.Context, route string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(e.URL, "/")+"/api"+route, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := e.Client
+	if client == nil {
+		client = &http.Client{Timeout: ExplorerTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: error reading response: %w", route, err)
+	}
+
+	// A 404 alone isn't enough to tell that a transaction doesn't
+	// exist, since a proxy in front of the explorer can send it too
+	success := resp.StatusCode >= 200 && resp.StatusCode <= 299
+	if message := explorerError(body, success); message != "" {
+		for _, notFound := range explorerNotFoundMessages {
+			if strings.Contains(message, notFound) {
+				return nil, fmt.Errorf("%s: %s: %w", route, message, ErrNotFound)
+			}
+		}
+		return nil, fmt.Errorf("%s: %s: %s", route, resp.Status, message)
+	}
+	if !success {
+		return nil, fmt.Errorf("%s: %s", route, resp.Status)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, fmt.Errorf("%s: empty response", route)
+	}
+	return body, nil
+}
+
+// explorerError returns the error in the body of a response, which is
+// the "error" of a JSON object, or the whole body of an unsuccessful
+// response that isn't JSON
+func explorerError(body []byte, success bool) string {
+	var object struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &object); err != nil {
+		if success {
+			return ""
+		}
+		message := strings.TrimSpace(string(body))
+		if len(message) > explorerErrorLength {
+			message = message[:explorerErrorLength] + "..."
+		}
+		return message
+	}
+	if len(object.Error) == 0 || string(object.Error) == "null" {
+		return ""
+	}
+	// The error is usually a string, but bitcoind
+	// errors are objects with a message
+	var message string
+	if err := json.Unmarshal(object.Error, &message); err == nil {
+		return message
+	}
+	return string(object.Error)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestExplorerErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		notFound bool
+		wantErr  bool
+	}{
+		{
+			name:   "transaction",
+			status: http.StatusOK,
+			body:   `{"txid":"aa","vout":[]}`,
+		},
+		{
+			name:     "unknown transaction",
+			status:   http.StatusInternalServerError,
+			body:     `{"error":{"code":-5,"message":"No such mempool or blockchain transaction."}}`,
+			notFound: true,
+			wantErr:  true,
+		},
+		{
+			name:     "unknown transaction with success status",
+			status:   http.StatusOK,
+			body:     `{"error":"No such mempool or blockchain transaction."}`,
+			notFound: true,
+			wantErr:  true,
+		},
+		{
+			name:    "rate limited",
+			status:  http.StatusTooManyRequests,
+			body:    `{"error":"Too many requests, please try again later."}`,
+			wantErr: true,
+		},
+		{
+			name:    "bad gateway",
+			status:  http.StatusBadGateway,
+			body:    `<html><body>502 Bad Gateway</body></html>`,
+			wantErr: true,
+		},
+		{
+			name:    "not found from a proxy",
+			status:  http.StatusNotFound,
+			body:    `404 page not found`,
+			wantErr: true,
+		},
+		{
+			name:    "other error",
+			status:  http.StatusOK,
+			body:    `{"error":{"code":-28,"message":"Loading block index..."}}`,
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			status:  http.StatusOK,
+			wantErr: true,
+		},
+		{
+			name:    "not JSON",
+			status:  http.StatusOK,
+			body:    `Too many requests`,
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+
+			e := Explorer{URL: server.URL, Client: server.Client()}
+			_, err := e.Tx(context.Background(), "aa")
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %t", err, test.wantErr)
+			}
+			if errors.Is(err, ErrNotFound) != test.notFound {
+				t.Errorf("got %v, want not found %t", err, test.notFound)
+			}
+		})
+	}
+}
+
+func TestAddressSummaryPages(t *testing.T) {
+	txids := []string{}
+	for i := 0; i < 120; i++ {
+		txids = append(txids, fmt.Sprintf("tx%03d", i))
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		// The explorer can return fewer transactions than requested
+		if limit > 25 {
+			limit = 25
+		}
+		page := txids[offset:]
+		if len(page) > limit {
+			page = page[:limit]
+		}
+		heights := map[string]int{}
+		for _, txid := range page {
+			heights[txid] = 100
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"txHistory": map[string]interface{}{
+				"txCount":            len(txids),
+				"txids":              page,
+				"blockHeightsByTxid": heights,
+				"balanceSat":         5000,
+			},
+		})
+	}))
+	defer server.Close()
+
+	e := Explorer{URL: server.URL, Client: server.Client()}
+	summary, err := e.AddressSummary(context.Background(), "bc1q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.TXHistory.TXIDs) != len(txids) || len(summary.TXHistory.BlockHeightsByTxid) != len(txids) {
+		t.Fatalf("got %d transactions and %d heights, want %d",
+			len(summary.TXHistory.TXIDs), len(summary.TXHistory.BlockHeightsByTxid), len(txids))
+	}
+	for i, txid := range summary.TXHistory.TXIDs {
+		if txid != txids[i] {
+			t.Errorf("transaction %d is %s, want %s", i, txid, txids[i])
+		}
+	}
+	if summary.TXHistory.BalanceSat != 5000 {
+		t.Errorf("got balance %d, want 5000", summary.TXHistory.BalanceSat)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// BalanceHistory is a balance observed for a watched identifier
+// (address or pubkey) at a point in time
+type BalanceHistory struct {
+	ID         uint   `gorm:"primaryKey"`
+	Identifier string `gorm:"index:idx_balance_history_identifier_time"`
+	// Time is stored in UTC, since times are stored as text
+	// and compared as text when querying a range
+	Time            time.Time `gorm:"index:idx_balance_history_identifier_time"`
+	Kind            string
+	BalanceSat      int
+	BalanceCurrency string
+	Currency        string
+	Price           float64
+	TXCount         int
+	BlockHeight     int
+	// Reorged is set on balances that were observed on blocks that were
+	// later removed from the chain by a reorganization
+	Reorged bool
+}
+
+// HistoryPOST is used to query the balance history of an identifier.
+// From and To are RFC3339 timestamps and are optional.
+type HistoryPOST struct {
+	Identifier string `json:"identifier"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+}
+
+// HistoryResponse is the response from a
+// GetHistory request
+type HistoryResponse struct {
+	Errors  string           `json:"errors,omitempty"`
+	History []BalanceHistory `json:"history"`
+}
+
+// RecordBalanceHistory stores the balance from a BalanceEvent along with
+// the price and block height it was observed at, which aren't looked
+// up once ctx is done
+func (w Watcher) RecordBalanceHistory(ctx context.Context, e BalanceEvent) {
+	h := BalanceHistory{
+		Identifier:      e.Identifier,
+		Time:            e.Time.UTC(),
+		Kind:            e.Kind,
+		BalanceSat:      e.BalanceSat,
+		BalanceCurrency: e.BalanceCurrency,
+		Currency:        e.Currency,
+		TXCount:         e.TXCount,
+	}
+
+	price, err := w.Price(ctx, e.Currency)
+	if err != nil {
+		log.Errorf("unable to get price for history of \"%s\" (%s): %v", e.Nickname, e.Identifier, err)
+	}
+	h.Price = price
+	height, err := w.TipHeight(ctx)
+	if err != nil {
+		log.Errorf("unable to get tip height for history of \"%s\" (%s): %v", e.Nickname, e.Identifier, err)
+	}
+	h.BlockHeight = height
+
+	if tx := w.DB.Create(&h); tx.Error != nil {
+		log.Errorf("unable to save history for \"%s\" (%s): %v", e.Nickname, e.Identifier, tx.Error)
+	}
+}
+
+// NormalizeBalanceHistoryTimes converts the times of balance history
+// recorded with a local time zone to UTC, so they can be compared
+func (w Watcher) NormalizeBalanceHistoryTimes() error {
+	var local []BalanceHistory
+	if tx := w.DB.Model(&BalanceHistory{}).Where("time NOT LIKE ?", "%+00:00").Find(&local); tx.Error != nil {
+		return tx.Error
+	}
+	for _, h := range local {
+		tx := w.DB.Model(&BalanceHistory{}).Where("id = ?", h.ID).Update("time", h.Time.UTC())
+		if tx.Error != nil {
+			return tx.Error
+		}
+	}
+	if len(local) > 0 {
+		log.Infof("converted the times of %d balance history entries to UTC", len(local))
+	}
+	return nil
+}
+
+// CorrectBalanceHistory marks the balances of an identifier that were
+// observed at or after the earliest block removed by a reorganization
+func (w Watcher) CorrectBalanceHistory(e BalanceEvent) {
+	height := 0
+	for _, t := range e.Transactions {
+		if height == 0 || t.BlockHeight < height {
+			height = t.BlockHeight
+		}
+	}
+	tx := w.DB.Model(&BalanceHistory{}).
+		Where("identifier = ? AND block_height >= ?", e.Identifier, height).
+		Update("reorged", true)
+	if tx.Error != nil {
+		log.Errorf("unable to correct history for \"%s\" (%s): %v", e.Nickname, e.Identifier, tx.Error)
+	}
+}
+
+// DeleteBalanceHistory deletes all history for an identifier
+func (w Watcher) DeleteBalanceHistory(identifier string) {
+	w.DB.Where(&BalanceHistory{Identifier: identifier}).Delete(&BalanceHistory{})
+}
+
+// GetHistory returns the balance history of an identifier (address or
+// pubkey), optionally limited to a time range
+func (w Watcher) GetHistory(c *gin.Context) {
+	body, _ := ioutil.ReadAll(c.Request.Body)
+	var req HistoryPOST
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusInternalServerError, HistoryResponse{
+			Errors: fmt.Sprint(err),
+		})
+		return
+	}
+	req.Identifier = NormalizeIdentifier(req.Identifier)
+
+	status := http.StatusOK
+	query := w.DB.Model(&BalanceHistory{}).Where(&BalanceHistory{Identifier: req.Identifier})
+	for _, bound := range []struct {
+		value     string
+		condition string
+	}{
+		{req.From, "time >= ?"},
+		{req.To, "time <= ?"},
+	} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := time.Parse(TimeFormatter, bound.value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, HistoryResponse{
+				Errors: fmt.Sprintf("invalid time \"%s\": %v", bound.value, err),
+			})
+			return
+		}
+		query = query.Where(bound.condition, t.UTC())
+	}
+
+	response := HistoryResponse{History: []BalanceHistory{}}
+	query.Order("time").Find(&response.History)
+	c.JSON(status, response)
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	cfg "github.com/golobby/config/v3"
@@ -81,12 +82,53 @@ func (w *Watcher) FillDefaults() {
 	if w.SleepInterval == 0 {
 		w.SleepInterval = DefaultSleepInterval
 	}
+	if w.SleepJitter == 0 {
+		w.SleepJitter = w.SleepInterval / 10
+	}
+	if w.PollMode == "" {
+		w.PollMode = PollModeInterval
+	}
+	if mode, err := ParsePollMode(w.PollMode); err != nil {
+		log.Fatal("invalid POLL_MODE: ", err)
+	} else {
+		w.PollMode = mode
+	}
+	if w.TipInterval <= 0 {
+		w.TipInterval = DefaultTipInterval
+	}
+	if w.MempoolInterval <= 0 {
+		w.MempoolInterval = w.SleepInterval * DefaultMempoolIntervalFactor
+	}
+	if w.ShutdownTimeout <= 0 {
+		w.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if w.MaxConcurrentChecks <= 0 {
+		w.MaxConcurrentChecks = DefaultMaxConcurrentChecks
+	}
 	if w.Lookahead == 0 {
 		w.Lookahead = DefaultLookahead
 	}
+	if w.NotificationMaxAttempts == 0 {
+		w.NotificationMaxAttempts = DefaultNotificationMaxAttempts
+	}
+	if w.NotificationRetryInterval == 0 {
+		w.NotificationRetryInterval = DefaultNotificationRetryInterval
+	}
 	if w.PageSize == 0 {
 		w.PageSize = DefaultPageSize
 	}
+	if w.DustThreshold == 0 {
+		w.DustThreshold = DefaultDustThreshold
+	}
+	if w.ReorgCheckDepth == 0 {
+		w.ReorgCheckDepth = DefaultReorgCheckDepth
+	}
+	if w.RequestsPerSecond == 0 {
+		w.RequestsPerSecond = DefaultRequestsPerSecond
+	}
+	if w.ScanWorkers <= 0 {
+		w.ScanWorkers = DefaultScanWorkers
+	}
 	if w.DBPath == "" {
 		w.DBPath = DefaultDBPath
 	}
@@ -96,6 +138,18 @@ func (w *Watcher) FillDefaults() {
 	if w.Currency == "" {
 		w.Currency = CurrencyUSD
 	}
+	if w.Network == "" {
+		w.Network = NetworkMainnet
+	}
+	if err := SetNetwork(w.Network); err != nil {
+		log.Fatal("invalid NETWORK: ", err)
+	}
+	if chainParams.Name != NetworkMainnet && w.BTCAPIEndpoint == DefaultApi {
+		log.Warnf("NETWORK is %s but BTC_RPC_API is the mainnet explorer %s", chainParams.Name, DefaultApi)
+	}
+	if _, err := ParseMilestones(w.ConfirmationMilestones); err != nil {
+		log.Fatal("invalid CONFIRMATION_MILESTONES: ", err)
+	}
 
 	// Set up DB path
 	// Create the folder path if it doesn't exist
@@ -108,31 +162,44 @@ func (w *Watcher) FillDefaults() {
 	}
 }
 
-// StartWatches starts goroutines for watching all of the known
-// addresses in the database.
-func (w *Watcher) StartWatches() {
-	w.CancelWaitGroup = &sync.WaitGroup{}
+// StartWatches schedules checks of all of the known addresses
+// and pubkeys in the database that aren't paused until ctx is done
+func (w *Watcher) StartWatches(ctx context.Context) {
+	w.Watches = NewWatchRegistry()
+	if w.PollMode == PollModeBlocks {
+		w.Tip = NewTipTracker()
+	}
+	// The check functions are bound to a copy of the Watcher,
+	// so the Scheduler is created after everything they use
+	w.Scheduler = NewScheduler(w.MaxConcurrentChecks, time.Duration(w.SleepJitter)*time.Second,
+		w.CheckWatch, w.CheckInterval)
 	// Check balance of each address
 	addresses := []AddressInfo{}
 	w.DB.Model(&AddressInfo{}).Scan(&addresses)
-	w.CancelSignals = map[string]chan bool{}
+	paused := 0
 	for _, address := range addresses {
-		// This channel is used to send a signal to stop watching the address
-		cancel := make(chan bool, 1)
-		w.CancelWaitGroup.Add(1)
-		w.AddCancelSignal(address.Address, cancel)
-		go w.WatchAddress(cancel, address.Address)
+		w.Watches.Add(address.Address)
+		if address.Paused {
+			paused++
+			continue
+		}
+		w.Scheduler.Schedule(address.Address, time.Now().Add(w.Scheduler.Jitter()))
 	}
 
 	// Check balance of each key of each pubkey
 	pubkeys := []PubkeyInfo{}
 	w.DB.Model(&PubkeyInfo{}).Scan(&pubkeys)
 	for _, pubkey := range pubkeys {
-		// This channel is used to send a signal to stop watching the pubkey
-		cancel := make(chan bool, 1)
-		w.CancelWaitGroup.Add(1)
-		w.AddCancelSignal(pubkey.Pubkey, cancel)
-		go w.WatchPubkey(cancel, pubkey.Pubkey)
+		w.Watches.Add(pubkey.Pubkey)
+		if pubkey.Paused {
+			paused++
+			continue
+		}
+		w.Scheduler.Schedule(pubkey.Pubkey, time.Now().Add(w.Scheduler.Jitter()))
+	}
+	go w.Scheduler.Run(ctx)
+	if w.Tip != nil {
+		go w.WatchTip(ctx)
 	}
-	log.Infof("watching %d addresses and %d pubkeys", len(addresses), len(pubkeys))
+	log.Infof("watching %d addresses and %d pubkeys (%d paused)", len(addresses), len(pubkeys), paused)
 }
@@ -1,42 +1,74 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
 	"reflect"
-	"sync"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
-	"github.com/tyzbit/btcapi"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
 type Watcher struct {
-	BTCAPI              btcapi.Config
-	CancelWaitGroup     *sync.WaitGroup
-	CancelSignals       map[string]chan bool
-	DB                  *gorm.DB
-	LogConfig           logger.Interface
+	DB           *gorm.DB
+	Explorer     Explorer
+	LogConfig    logger.Interface
+	Notifiers    []Notifier
+	OutboxSignal chan bool
+	Scheduler    *Scheduler
+	Tip          *TipTracker
+	Watches      *WatchRegistry
 	Config
 }
 
 type Config struct {
-	BTCAPIEndpoint      string `env:"BTC_RPC_API"`
-	CheckAllPubkeyTypes bool   `env:"CHECK_ALL_PUBKEY_TYPES"`
-	Currency            string `env:"CURRENCY"`
-	DBPath              string `env:"DB_PATH"`
-	DiscordWebhook      string `env:"DISCORD_WEBHOOK"`
-	SleepInterval       int    `env:"SLEEP_INTERVAL"`
-	LogLevel            string `env:"LOG_LEVEL"`
-	Lookahead           int    `env:"LOOKAHEAD"`
-	PageSize            int    `env:"PAGE_SIZE"`
-	Port                string `env:"PORT"`
-}
-
-type DiscordPayload struct {
-	Content string `json:"content"`
+	BTCAPIEndpoint            string `env:"BTC_RPC_API"`
+	CheckAllPubkeyTypes       bool   `env:"CHECK_ALL_PUBKEY_TYPES"`
+	ConfirmationMilestones    string `env:"CONFIRMATION_MILESTONES"`
+	Currency                  string `env:"CURRENCY"`
+	DBPath                    string `env:"DB_PATH"`
+	DefaultNotifiers          string `env:"DEFAULT_NOTIFIERS"`
+	DiscordWebhook            string `env:"DISCORD_WEBHOOK"`
+	DustThreshold             int    `env:"DUST_THRESHOLD"`
+	EnabledNotifiers          string `env:"NOTIFIERS"`
+	SleepInterval             int    `env:"SLEEP_INTERVAL"`
+	SleepJitter               int    `env:"SLEEP_JITTER"`
+	LogLevel                  string `env:"LOG_LEVEL"`
+	Lookahead                 int    `env:"LOOKAHEAD"`
+	MaxConcurrentChecks       int    `env:"MAX_CONCURRENT_CHECKS"`
+	MempoolInterval           int    `env:"MEMPOOL_INTERVAL"`
+	Network                   string `env:"NETWORK"`
+	NotificationMaxAttempts   int    `env:"NOTIFICATION_MAX_ATTEMPTS"`
+	NotificationRetryInterval int    `env:"NOTIFICATION_RETRY_INTERVAL"`
+	PageSize                  int    `env:"PAGE_SIZE"`
+	PollMode                  string `env:"POLL_MODE"`
+	Port                      string `env:"PORT"`
+	ReorgCheckDepth           int    `env:"REORG_CHECK_DEPTH"`
+	RequestsPerSecond         int    `env:"REQUESTS_PER_SECOND"`
+	ScanWorkers               int    `env:"SCAN_WORKERS"`
+	ShutdownTimeout           int    `env:"SHUTDOWN_TIMEOUT"`
+	SlackWebhook              string `env:"SLACK_WEBHOOK"`
+	SMTPFrom                  string `env:"SMTP_FROM"`
+	SMTPHost                  string `env:"SMTP_HOST"`
+	SMTPPassword              string `env:"SMTP_PASSWORD"`
+	SMTPPort                  int    `env:"SMTP_PORT"`
+	SMTPTLS                   string `env:"SMTP_TLS"`
+	SMTPTo                    string `env:"SMTP_TO"`
+	SMTPUsername              string `env:"SMTP_USERNAME"`
+	TelegramAPIURL            string `env:"TELEGRAM_API_URL"`
+	TelegramBotToken          string `env:"TELEGRAM_BOT_TOKEN"`
+	TelegramChatID            string `env:"TELEGRAM_CHAT_ID"`
+	TipInterval               int    `env:"TIP_INTERVAL"`
+	WebhookSecret             string `env:"WEBHOOK_SECRET"`
+	WebhookURL                string `env:"WEBHOOK_URL"`
 }
 
 const (
@@ -52,6 +84,13 @@ var (
 	allSchemaTypes = []interface{}{
 		&AddressInfo{},
 		&PubkeyInfo{},
+		&OutboxNotification{},
+		&MessageTemplate{},
+		&BalanceHistory{},
+		&WatchedTransaction{},
+		&AlertRule{},
+		&DustOutput{},
+		&DerivedAddress{},
 	}
 	watcher Watcher
 	//go:embed web
@@ -63,6 +102,10 @@ func init() {
 
 	// Set defaults and throw errors if necessary values aren't set
 	watcher.FillDefaults()
+
+	if err := watcher.InitNotifiers(); err != nil {
+		log.Fatal("unable to set up notifiers: ", err)
+	}
 }
 
 func main() {
@@ -78,18 +121,46 @@ func main() {
 		}
 	}
 
-	// Set up BTC-RPC
-	watcher.BTCAPI = btcapi.Config{
-		ExplorerURL: watcher.Config.BTCAPIEndpoint,
+	if err := watcher.NormalizeBalanceHistoryTimes(); err != nil {
+		log.Fatal("unable to convert balance history times to UTC: ", err)
+	}
+	if err := watcher.NormalizeIdentifiers(); err != nil {
+		log.Fatal("unable to normalize identifiers: ", err)
 	}
 
-	watcher.StartWatches()
+	// Set up BTC-RPC
+	watcher.Explorer = watcher.NewExplorer()
+
+	// ctx is done on the first SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Deliver notifications in the background so a slow or
+	// unavailable notifier doesn't hold up the watches
+	watcher.OutboxSignal = make(chan bool, 1)
+	outboxDone := make(chan bool)
+	go func() {
+		watcher.RunOutbox(ctx)
+		close(outboxDone)
+	}()
+
+	watcher.StartWatches(ctx)
 	r := gin.New()
 	r.Use(gin.LoggerWithFormatter(GinJSONFormatter))
 	InitFrontend(r)
 	InitBackend(r)
 
-	if err := r.Run(":"+watcher.Config.Port); err != nil {
-		log.Fatal("could not start: ", err)
-	}
+	server := &http.Server{Addr: ":" + watcher.Config.Port, Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("could not start: ", err)
+		}
+	}()
+
+	<-ctx.Done()
+	// A second signal exits right away
+	stop()
+	log.Info("shutting down")
+	watcher.Shutdown(server, outboxDone)
+	log.Info("shut down")
 }
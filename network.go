@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	NetworkMainnet string = "mainnet"
+	NetworkTestnet string = "testnet"
+	NetworkSignet  string = "signet"
+	NetworkRegtest string = "regtest"
+)
+
+// Network holds the address and extended key
+// encodings of a bitcoin network
+type Network struct {
+	Name string
+	// PubKeyHashID and ScriptHashID are the version bytes
+	// of legacy (P2PKH) and P2SH addresses
+	PubKeyHashID byte
+	ScriptHashID byte
+	// Bech32HRP is the human readable part of segwit addresses
+	Bech32HRP        string
+	ExtendedKeyTypes []ExtendedKeyType
+}
+
+// testnetKeyTypes are the extended key types of testnet, signet and regtest
+var testnetKeyTypes = []ExtendedKeyType{
+	{
+		Prefix:         "tpub",
+		Version:        0x043587cf,
+		OutputType:     OutputP2PKH,
+		OutputTypeDesc: "Pay to Public Key Hash (P2PKH)",
+		BIP32Path:      "m/44'/1'",
+	},
+	{
+		Prefix:         "upub",
+		Version:        0x044a5262,
+		OutputType:     OutputP2SHP2WPKH,
+		OutputTypeDesc: "Pay to Witness Public Key Hash (P2WPKH) wrapped inside Pay to Script Hash (P2SH), aka Wrapped Segwit",
+		BIP32Path:      "m/49'/1'",
+	},
+	{
+		Prefix:         "vpub",
+		Version:        0x045f1cf6,
+		OutputType:     OutputP2WPKH,
+		OutputTypeDesc: "Pay to Witness Public Key Hash (P2WPKH), aka Native Segwit",
+		BIP32Path:      "m/84'/1'",
+	},
+}
+
+// networks holds every supported network by name
+var networks = map[string]Network{
+	NetworkMainnet: {
+		Name:         NetworkMainnet,
+		PubKeyHashID: 0x00,
+		ScriptHashID: 0x05,
+		Bech32HRP:    "bc",
+		ExtendedKeyTypes: []ExtendedKeyType{
+			{
+				Prefix:         "xpub",
+				Version:        0x0488b21e,
+				OutputType:     OutputP2PKH,
+				OutputTypeDesc: "Pay to Public Key Hash (P2PKH)",
+				BIP32Path:      "m/44'/0'",
+			},
+			{
+				Prefix:         "ypub",
+				Version:        0x049d7cb2,
+				OutputType:     OutputP2SHP2WPKH,
+				OutputTypeDesc: "Pay to Witness Public Key Hash (P2WPKH) wrapped inside Pay to Script Hash (P2SH), aka Wrapped Segwit",
+				BIP32Path:      "m/49'/0'",
+			},
+			{
+				Prefix:         "zpub",
+				Version:        0x04b24746,
+				OutputType:     OutputP2WPKH,
+				OutputTypeDesc: "Pay to Witness Public Key Hash (P2WPKH), aka Native Segwit",
+				BIP32Path:      "m/84'/0'",
+			},
+		},
+	},
+	NetworkTestnet: {
+		Name:             NetworkTestnet,
+		PubKeyHashID:     0x6f,
+		ScriptHashID:     0xc4,
+		Bech32HRP:        "tb",
+		ExtendedKeyTypes: testnetKeyTypes,
+	},
+	NetworkSignet: {
+		Name:             NetworkSignet,
+		PubKeyHashID:     0x6f,
+		ScriptHashID:     0xc4,
+		Bech32HRP:        "tb",
+		ExtendedKeyTypes: testnetKeyTypes,
+	},
+	NetworkRegtest: {
+		Name:             NetworkRegtest,
+		PubKeyHashID:     0x6f,
+		ScriptHashID:     0xc4,
+		Bech32HRP:        "bcrt",
+		ExtendedKeyTypes: testnetKeyTypes,
+	},
+}
+
+// chainParams is the network set with NETWORK. Addresses are derived and
+// identifiers are accepted for this network only.
+var chainParams = networks[NetworkMainnet]
+
+// SetNetwork sets the network addresses and keys are used with
+func SetNetwork(name string) error {
+	n, ok := networks[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown network %q, expected %s, %s, %s or %s",
+			name, NetworkMainnet, NetworkTestnet, NetworkSignet, NetworkRegtest)
+	}
+	chainParams = n
+	return nil
+}
+
+// otherNetworks returns the names of the networks besides chainParams
+// that match, for errors about identifiers from the wrong network
+func otherNetworks(match func(Network) bool) string {
+	names := []string{}
+	for _, name := range []string{NetworkMainnet, NetworkTestnet, NetworkSignet, NetworkRegtest} {
+		if name != chainParams.Name && match(networks[name]) {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "/")
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	KindAddress    string = "address"
+	KindPubkey     string = "pubkey"
+	KindDescriptor string = "descriptor"
+
+	// EventBalanceChanged is sent when the balance or
+	// transactions of a watch change
+	EventBalanceChanged string = "balance_changed"
+	// EventUnconfirmed is sent when an incoming transaction
+	// is first seen in the mempool
+	EventUnconfirmed string = "unconfirmed"
+	// EventConfirmed is sent when pending transactions are mined
+	EventConfirmed string = "confirmed"
+	// EventMilestone is sent when transactions reach
+	// a confirmation milestone
+	EventMilestone string = "confirmation_milestone"
+	// EventReorg is sent when confirmed transactions are
+	// removed from the chain by a reorganization
+	EventReorg string = "reorg"
+	// EventDust is sent when transactions only send dust
+	EventDust string = "dust"
+
+	PriorityNormal string = "normal"
+	PriorityHigh   string = "high"
+
+	// NotifierTimeout limits how long a notifier can take to deliver a
+	// notification, so one that hangs doesn't hold up the outbox
+	NotifierTimeout time.Duration = 30 * time.Second
+)
+
+// Notifier is implemented by every destination that can
+// receive balance change notifications
+type Notifier interface {
+	// Name returns the name used to enable the notifier in the configuration
+	Name() string
+	// Notify delivers a BalanceEvent to the destination,
+	// giving up when ctx is done
+	Notify(context.Context, BalanceEvent) error
+}
+
+// NotifierFactory creates a Notifier from the configuration,
+// returning an error if required values are missing
+type NotifierFactory func(Config) (Notifier, error)
+
+// notifierFactories holds every notifier that can be enabled
+// with the NOTIFIERS setting, keyed by name
+var notifierFactories = map[string]NotifierFactory{
+	NotifierDiscord:  NewDiscordNotifier,
+	NotifierEmail:    NewEmailNotifier,
+	NotifierSlack:    NewSlackNotifier,
+	NotifierTelegram: NewTelegramNotifier,
+	NotifierWebhook:  NewWebhookNotifier,
+}
+
+// BalanceEvent is a structured description of a balance change for
+// a watched identifier (address or pubkey)
+type BalanceEvent struct {
+	Type                    string               `json:"type"`
+	Kind                    string               `json:"kind"`
+	Network                 string               `json:"network"`
+	Identifier              string               `json:"identifier"`
+	Nickname                string               `json:"nickname"`
+	BalanceSat              int                  `json:"balanceSat"`
+	ConfirmedBalanceSat     int                  `json:"confirmedBalanceSat"`
+	PendingBalanceSat       int                  `json:"pendingBalanceSat"`
+	SpendableBalanceSat     int                  `json:"spendableBalanceSat"`
+	PreviousBalanceSat      int                  `json:"previousBalanceSat"`
+	Currency                string               `json:"currency"`
+	BalanceCurrency         string               `json:"balanceCurrency"`
+	PreviousBalanceCurrency string               `json:"previousBalanceCurrency"`
+	TXCount                 int                  `json:"txCount"`
+	Transactions            []WatchedTransaction `json:"transactions"`
+	Milestone               int                  `json:"milestone,omitempty"`
+	Priority                string               `json:"priority"`
+	Notifiers               string               `json:"notifiers"`
+	Template                string               `json:"template"`
+	MessageTemplate         string               `json:"messageTemplate,omitempty"`
+	Time                    time.Time            `json:"time"`
+}
+
+// KindName returns the capitalized kind of the event for display
+func (e BalanceEvent) KindName() string {
+	switch e.Kind {
+	case KindPubkey:
+		return "Pubkey"
+	case KindDescriptor:
+		return "Descriptor"
+	}
+	return "Address"
+}
+
+// Title returns a short headline for the event. Events
+// from networks other than mainnet are prefixed with it.
+func (e BalanceEvent) Title() string {
+	var title string
+	switch e.Type {
+	case EventUnconfirmed:
+		title = "Incoming Transaction (Unconfirmed)"
+	case EventConfirmed:
+		title = "Transaction Confirmed"
+	case EventMilestone:
+		title = fmt.Sprintf("Transaction Reached %d Confirmations", e.Milestone)
+	case EventDust:
+		title = "Possible Dust Attack"
+	case EventReorg:
+		title = "Chain Reorganization: Confirmed Transaction Removed"
+	default:
+		title = e.KindName() + " Balance Changed"
+	}
+	if e.Network != "" && e.Network != NetworkMainnet {
+		title = "[" + e.Network + "] " + title
+	}
+	return title
+}
+
+// Message renders the event with its message template, or the
+// built-in template for its kind if none is set
+func (e BalanceEvent) Message() (string, error) {
+	return e.EscapedMessage(nil)
+}
+
+// EscapedMessage renders the event like Message, escaping
+// it with escaper if it isn't nil
+func (e BalanceEvent) EscapedMessage(escaper *Escaper) (string, error) {
+	if e.MessageTemplate != "" {
+		return RenderEscapedMessageTemplate("customMessage", e.MessageTemplate, e, escaper)
+	}
+	mt := addressMessageTemplate
+	if e.Kind == KindPubkey || e.Kind == KindDescriptor {
+		mt = pubkeyMessageTemplate
+	}
+	return RenderEscapedMessageTemplate(e.Kind+"Message", mt, e, escaper)
+}
+
+// InitNotifiers creates every notifier listed in the configuration
+func (w *Watcher) InitNotifiers() error {
+	names := w.EnabledNotifiers
+	// Discord was the only notifier before NOTIFIERS existed
+	if names == "" && w.DiscordWebhook != "" {
+		names = NotifierDiscord
+	}
+
+	w.Notifiers = []Notifier{}
+	for _, name := range SplitList(names) {
+		factory, ok := notifierFactories[name]
+		if !ok {
+			return fmt.Errorf("unknown notifier \"%s\"", name)
+		}
+		notifier, err := factory(w.Config)
+		if err != nil {
+			return fmt.Errorf("unable to set up notifier \"%s\": %w", name, err)
+		}
+		w.Notifiers = append(w.Notifiers, notifier)
+	}
+
+	if len(w.Notifiers) == 0 {
+		log.Warn("no notifiers are configured, balance changes will only be logged")
+	}
+	if err := w.ValidateNotifiers(w.DefaultNotifiers); err != nil {
+		return fmt.Errorf("invalid DEFAULT_NOTIFIERS: %w", err)
+	}
+	return nil
+}
+
+// ReportChanges compares the current state of a watch to its previous
+// state after a check, saves it, and records and sends notifications for
+// the balance and transaction changes found. If firstScan is true, the
+// state is saved even if nothing changed.
+func (w Watcher) ReportChanges(ctx context.Context, previous Info, current Info, firstScan bool, changes TransactionChanges) {
+	old, e := previous.BalanceEvent(), current.BalanceEvent()
+	balanceChanged := e.BalanceSat != old.BalanceSat || len(changes.New) > 0
+	if balanceChanged || e.PendingBalanceSat != old.PendingBalanceSat ||
+		len(changes.Confirmed) > 0 || len(changes.Reorged) > 0 || firstScan {
+		w.UpdateInfo(current)
+	}
+
+	if len(changes.Reorged) > 0 {
+		re := current.BalanceEvent()
+		re.Type = EventReorg
+		re.Priority = PriorityHigh
+		re.Transactions = changes.Reorged
+		w.CorrectBalanceHistory(re)
+		// A balance change records its own history below
+		if !balanceChanged {
+			w.RecordBalanceHistory(ctx, re)
+		}
+		w.SendNotification(re)
+	}
+
+	if balanceChanged {
+		log.Infof("\"%s\" (%s) balance updated from %d to %d sats",
+			e.Nickname, e.Identifier, old.BalanceSat, e.BalanceSat)
+		e.Type = EventBalanceChanged
+		for _, t := range changes.New {
+			if !t.Confirmed() && t.Direction == DirectionIncoming {
+				e.Type = EventUnconfirmed
+			}
+		}
+		// Dust is always reported with its own alert
+		dust := DustTransactions(changes.New)
+		if len(dust) > 0 && len(dust) == len(changes.New) {
+			e.Type = EventDust
+		}
+		e.Transactions = changes.New
+		w.RecordBalanceHistory(ctx, e)
+		if e.Type == EventDust || w.MatchAlertRules(ctx, e) {
+			w.SendNotification(e)
+		} else {
+			log.Infof("no alert rules matched for \"%s\" (%s), not notifying", e.Nickname, e.Identifier)
+			w.SuppressTransactions(changes.New)
+		}
+		if len(dust) > 0 && e.Type != EventDust {
+			de := current.BalanceEvent()
+			de.Type = EventDust
+			de.Transactions = dust
+			w.SendNotification(de)
+		}
+		// Dust isn't followed until it's confirmed
+		w.SuppressTransactions(dust)
+	}
+
+	// Follow-ups are only sent for transactions that were notified
+	if confirmed := NotifiedTransactions(changes.Confirmed); len(confirmed) > 0 {
+		ce := current.BalanceEvent()
+		ce.Type = EventConfirmed
+		ce.Transactions = confirmed
+		w.SendNotification(ce)
+	}
+
+	milestones := []int{}
+	for m := range changes.Milestones {
+		milestones = append(milestones, m)
+	}
+	sort.Ints(milestones)
+	for _, m := range milestones {
+		reached := NotifiedTransactions(changes.Milestones[m])
+		if len(reached) == 0 {
+			continue
+		}
+		me := current.BalanceEvent()
+		me.Type = EventMilestone
+		me.Milestone = m
+		me.Transactions = reached
+		w.SendNotification(me)
+	}
+}
+
+// SendNotification queues a BalanceEvent for delivery to the
+// notifiers the watch is routed to
+func (w Watcher) SendNotification(e BalanceEvent) {
+	w.EnqueueNotification(e)
+}
+
+// RouteNotifiers returns the enabled notifiers named in a comma-separated
+// list, falling back to DEFAULT_NOTIFIERS and then every enabled notifier
+func (w Watcher) RouteNotifiers(names string) []Notifier {
+	if names == "" {
+		names = w.DefaultNotifiers
+	}
+	if names == "" {
+		return w.Notifiers
+	}
+
+	notifiers := []Notifier{}
+	for _, name := range SplitList(names) {
+		notifier := w.GetNotifier(name)
+		if notifier == nil {
+			log.Warnf("notifier %s is not enabled, skipping", name)
+			continue
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	return notifiers
+}
+
+// ValidateNotifiers returns an error if a comma-separated list
+// names a notifier that isn't enabled
+func (w Watcher) ValidateNotifiers(names string) error {
+	for _, name := range SplitList(names) {
+		if w.GetNotifier(name) == nil {
+			return fmt.Errorf("notifier \"%s\" is not enabled", name)
+		}
+	}
+	return nil
+}
+
+// SplitList splits a comma-separated list into its lowercased,
+// trimmed, non-empty entries
+func SplitList(list string) (entries []string) {
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// postJSON encodes payload as JSON and POSTs it to url
+func postJSON(ctx context.Context, url string, payload interface{}) (*http.Response, error) {
+	var m bytes.Buffer
+	if err := json.NewEncoder(&m).Encode(payload); err != nil {
+		return nil, fmt.Errorf("unable to encode payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &m)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := http.Client{Timeout: NotifierTimeout}
+	return client.Do(req)
+}
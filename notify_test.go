@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRoutingWatcher returns a Watcher with test notifiers
+// named discord, slack and email enabled
+func newRoutingWatcher(defaultNotifiers string) Watcher {
+	events := []BalanceEvent{}
+	w := Watcher{}
+	w.DefaultNotifiers = defaultNotifiers
+	for _, name := range []string{NotifierDiscord, NotifierSlack, NotifierEmail} {
+		w.Notifiers = append(w.Notifiers, testNotifier{name: name, events: &events})
+	}
+	return w
+}
+
+func TestRouteNotifiers(t *testing.T) {
+	tests := []struct {
+		name             string
+		defaultNotifiers string
+		watchNotifiers   string
+		want             string
+	}{
+		{"watch setting", NotifierEmail, "slack", "slack"},
+		{"several", "", " Slack ,discord", "slack,discord"},
+		{"default", NotifierEmail, "", "email"},
+		{"every notifier", "", "", "discord,slack,email"},
+		{"notifier that isn't enabled", "", "slack,teams", "slack"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := newRoutingWatcher(test.defaultNotifiers)
+			names := []string{}
+			for _, n := range w.RouteNotifiers(test.watchNotifiers) {
+				names = append(names, n.Name())
+			}
+			if got := strings.Join(names, ","); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateNotifiers(t *testing.T) {
+	w := newRoutingWatcher("")
+	for _, names := range []string{"", "slack", "Slack, discord"} {
+		if err := w.ValidateNotifiers(names); err != nil {
+			t.Errorf("%q: %v", names, err)
+		}
+	}
+	for _, names := range []string{"teams", "slack,teams"} {
+		if err := w.ValidateNotifiers(names); err == nil {
+			t.Errorf("%q: notifier that isn't enabled was accepted", names)
+		}
+	}
+}
+
+func TestAddWatchUnknownNotifier(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := newRoutingWatcher("")
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/watch",
+		strings.NewReader(`{"identifier":"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4","notifiers":"teams"}`))
+
+	w.AddWatch(c)
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), "teams") {
+		t.Errorf("got %d %s, want %d", recorder.Code, recorder.Body.String(), http.StatusBadRequest)
+	}
+}
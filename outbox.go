@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	NotificationPending   string = "pending"
+	NotificationDelivered string = "delivered"
+	NotificationFailed    string = "failed"
+
+	DefaultNotificationMaxAttempts   int = 10
+	DefaultNotificationRetryInterval int = 30
+	// MaxNotificationRetryInterval caps the exponential backoff, in seconds
+	MaxNotificationRetryInterval int = 3600
+	// OutboxPollInterval is how often the outbox is checked for
+	// notifications that are due for another attempt
+	OutboxPollInterval time.Duration = 5 * time.Second
+	// NotificationsLimit is the maximum number of notifications returned
+	// by GetNotifications
+	NotificationsLimit int = 100
+)
+
+// OutboxNotification is a notification for a single notifier that is
+// persisted before delivery so it can be retried until it succeeds
+type OutboxNotification struct {
+	ID          uint      `gorm:"primaryKey"`
+	CreatedAt   time.Time `gorm:"index"`
+	UpdatedAt   time.Time
+	Notifier    string `gorm:"index"`
+	Identifier  string `gorm:"index"`
+	Priority    string
+	Event       string
+	Status      string `gorm:"index"`
+	Attempts    int
+	NextAttempt time.Time `gorm:"index"`
+	LastError   string
+	DeliveredAt *time.Time
+}
+
+// EnqueueNotification persists a BalanceEvent for every notifier the
+// event is routed to and wakes up the outbox worker to deliver them
+func (w Watcher) EnqueueNotification(e BalanceEvent) {
+	for _, notifier := range w.RouteNotifiers(e.Notifiers) {
+		// Templates are resolved now so edits to a template
+		// don't change notifications that are already queued
+		e.MessageTemplate = w.ResolveMessageTemplate(e, notifier.Name())
+		event, err := json.Marshal(e)
+		if err != nil {
+			log.Errorf("unable to encode event for \"%s\" (%s): %v", e.Nickname, e.Identifier, err)
+			continue
+		}
+
+		n := OutboxNotification{
+			Notifier:    notifier.Name(),
+			Identifier:  e.Identifier,
+			Priority:    e.Priority,
+			Event:       string(event),
+			Status:      NotificationPending,
+			NextAttempt: time.Now(),
+		}
+		if tx := w.DB.Create(&n); tx.Error != nil {
+			log.Errorf("unable to save %s notification for \"%s\" (%s): %v",
+				n.Notifier, e.Nickname, e.Identifier, tx.Error)
+		}
+	}
+
+	// Don't block if the worker has already been woken up
+	select {
+	case w.OutboxSignal <- true:
+	default:
+	}
+}
+
+// RunOutbox delivers pending notifications whenever one is enqueued
+// and periodically retries the ones that failed, until ctx is done
+func (w Watcher) RunOutbox(ctx context.Context) {
+	ticker := time.NewTicker(OutboxPollInterval)
+	defer ticker.Stop()
+	for {
+		w.DeliverPendingNotifications(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.OutboxSignal:
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverPendingNotifications attempts every pending notification
+// that is due, starting with the high priority ones, until ctx is done
+func (w Watcher) DeliverPendingNotifications(ctx context.Context) {
+	var pending []OutboxNotification
+	w.DB.Model(&OutboxNotification{}).
+		Where("status = ? AND next_attempt <= ?", NotificationPending, time.Now()).
+		Order(fmt.Sprintf("priority = '%s' DESC, id", PriorityHigh)).
+		Find(&pending)
+	for i := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		w.DeliverNotification(ctx, &pending[i])
+	}
+}
+
+// DeliverNotification makes one delivery attempt for a notification and
+// records the outcome, scheduling a retry with exponential backoff on failure.
+// An attempt cut short by ctx isn't counted, so it's retried right away
+// the next time.
+func (w Watcher) DeliverNotification(ctx context.Context, n *OutboxNotification) {
+	err := w.attemptDelivery(ctx, *n)
+	if err != nil && ctx.Err() != nil {
+		log.Warnf("%s notification %d for %s was interrupted: %v", n.Notifier, n.ID, n.Identifier, err)
+		return
+	}
+	n.Attempts++
+	if err == nil {
+		now := time.Now()
+		n.Status = NotificationDelivered
+		n.DeliveredAt = &now
+		n.LastError = ""
+	} else {
+		n.LastError = err.Error()
+		if n.Attempts >= w.NotificationMaxAttempts {
+			n.Status = NotificationFailed
+			log.Errorf("giving up on %s notification %d for %s after %d attempts: %v",
+				n.Notifier, n.ID, n.Identifier, n.Attempts, err)
+		} else {
+			n.NextAttempt = time.Now().Add(w.retryDelay(n.Attempts))
+			log.Warnf("%s notification %d for %s failed (attempt %d of %d), retrying at %s: %v",
+				n.Notifier, n.ID, n.Identifier, n.Attempts, w.NotificationMaxAttempts,
+				n.NextAttempt.Format(TimeFormatter), err)
+		}
+	}
+
+	if tx := w.DB.Save(n); tx.Error != nil {
+		log.Errorf("unable to update notification %d: %v", n.ID, tx.Error)
+	}
+}
+
+// attemptDelivery hands the stored event to the notifier it was queued for
+func (w Watcher) attemptDelivery(ctx context.Context, n OutboxNotification) error {
+	notifier := w.GetNotifier(n.Notifier)
+	if notifier == nil {
+		return fmt.Errorf("notifier %s is not enabled", n.Notifier)
+	}
+	var e BalanceEvent
+	if err := json.Unmarshal([]byte(n.Event), &e); err != nil {
+		return fmt.Errorf("unable to decode event: %w", err)
+	}
+	return notifier.Notify(ctx, e)
+}
+
+// retryDelay returns how long to wait before the next attempt, doubling
+// with every failed attempt
+func (w Watcher) retryDelay(attempts int) time.Duration {
+	delay := float64(w.NotificationRetryInterval) * math.Pow(2, float64(attempts-1))
+	delay = math.Min(delay, float64(MaxNotificationRetryInterval))
+	return time.Duration(delay) * time.Second
+}
+
+// GetNotifier returns the enabled notifier with the provided name, or nil
+func (w Watcher) GetNotifier(name string) Notifier {
+	for _, notifier := range w.Notifiers {
+		if notifier.Name() == name {
+			return notifier
+		}
+	}
+	return nil
+}
+
+// GetNotifications returns the most recent notifications and their
+// delivery status, optionally filtered by the status query parameter
+func (w Watcher) GetNotifications(c *gin.Context) {
+	status := http.StatusOK
+	query := w.DB.Model(&OutboxNotification{})
+	if s := c.Query("status"); s != "" {
+		query = query.Where(&OutboxNotification{Status: s})
+	}
+	notifications := []OutboxNotification{}
+	query.Order("id desc").Limit(NotificationsLimit).Find(&notifications)
+	c.JSON(status, notifications)
+}
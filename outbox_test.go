@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB returns an empty database in a temporary directory
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.sqlite")),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, schemaType := range allSchemaTypes {
+		if err := db.AutoMigrate(schemaType); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// testNotifier records the events it's given and fails with err
+type testNotifier struct {
+	name   string
+	err    error
+	events *[]BalanceEvent
+}
+
+func (n testNotifier) Name() string {
+	return n.name
+}
+
+func (n testNotifier) Notify(ctx context.Context, e BalanceEvent) error {
+	*n.events = append(*n.events, e)
+	return n.err
+}
+
+func TestRetryDelay(t *testing.T) {
+	w := Watcher{}
+	w.NotificationRetryInterval = 30
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, 60 * time.Second},
+		{3, 120 * time.Second},
+		{7, 1920 * time.Second},
+		// Capped at MaxNotificationRetryInterval
+		{8, time.Duration(MaxNotificationRetryInterval) * time.Second},
+		{50, time.Duration(MaxNotificationRetryInterval) * time.Second},
+	}
+	for _, test := range tests {
+		if got := w.retryDelay(test.attempts); got != test.want {
+			t.Errorf("attempt %d: got %s, want %s", test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestDeliverNotificationRetries(t *testing.T) {
+	events := []BalanceEvent{}
+	w := Watcher{DB: newTestDB(t)}
+	w.Notifiers = []Notifier{testNotifier{name: "test", err: errors.New("unreachable"), events: &events}}
+	w.NotificationMaxAttempts = 3
+	w.NotificationRetryInterval = 30
+	w.EnqueueNotification(BalanceEvent{Identifier: "bc1q", Nickname: "wallet"})
+
+	get := func() (n OutboxNotification) {
+		w.DB.Model(&OutboxNotification{}).First(&n)
+		return n
+	}
+	// makeDue moves the next attempt of the notification to now
+	makeDue := func() {
+		w.DB.Model(&OutboxNotification{}).Where("1 = 1").Update("next_attempt", time.Now())
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		before := time.Now()
+		w.DeliverPendingNotifications(context.Background())
+		n := get()
+		if n.Status != NotificationPending || n.Attempts != attempt || n.LastError != "unreachable" {
+			t.Fatalf("attempt %d: got status %s after %d attempts (%s)", attempt, n.Status, n.Attempts, n.LastError)
+		}
+		// The delay doubles with every attempt
+		delay := w.retryDelay(attempt)
+		if n.NextAttempt.Before(before.Add(delay)) || n.NextAttempt.After(time.Now().Add(delay)) {
+			t.Errorf("attempt %d: next attempt at %s, want %s after it", attempt, n.NextAttempt, delay)
+		}
+
+		// It isn't attempted again until it's due
+		w.DeliverPendingNotifications(context.Background())
+		if len(events) != attempt {
+			t.Fatalf("attempt %d: delivered %d times", attempt, len(events))
+		}
+		makeDue()
+	}
+
+	// The last attempt gives up
+	w.DeliverPendingNotifications(context.Background())
+	if n := get(); n.Status != NotificationFailed || n.Attempts != 3 {
+		t.Errorf("got status %s after %d attempts, want %s after 3", n.Status, n.Attempts, NotificationFailed)
+	}
+	makeDue()
+	w.DeliverPendingNotifications(context.Background())
+	if len(events) != 3 {
+		t.Errorf("delivered %d times, want 3", len(events))
+	}
+}
+
+func TestDeliverNotificationSucceeds(t *testing.T) {
+	events := []BalanceEvent{}
+	w := Watcher{DB: newTestDB(t)}
+	w.Notifiers = []Notifier{testNotifier{name: "test", events: &events}}
+	w.NotificationMaxAttempts = 3
+	w.NotificationRetryInterval = 30
+	w.EnqueueNotification(BalanceEvent{Identifier: "bc1q", Nickname: "wallet", BalanceSat: 1000})
+
+	w.DeliverPendingNotifications(context.Background())
+	var n OutboxNotification
+	w.DB.Model(&OutboxNotification{}).First(&n)
+	if n.Status != NotificationDelivered || n.Attempts != 1 || n.DeliveredAt == nil {
+		t.Errorf("got status %s after %d attempts, want %s after 1", n.Status, n.Attempts, NotificationDelivered)
+	}
+	if len(events) != 1 || events[0].Nickname != "wallet" || events[0].BalanceSat != 1000 {
+		t.Errorf("got events %+v, want the queued event", events)
+	}
+}
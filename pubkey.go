@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -14,11 +15,20 @@ type PubkeyInfo struct {
 	Pubkey                  string `gorm:"primaryKey"`
 	Nickname                string
 	BalanceSat              int
+	ConfirmedBalanceSat     int
+	PendingBalanceSat       int
+	SpendableBalanceSat     int
 	PreviousBalanceSat      int
 	Currency                string
 	BalanceCurrency         string
 	PreviousBalanceCurrency string
 	TXCount                 int
+	// TransactionsScanned is set once the existing transactions
+	// have been stored, so they aren't reported as new
+	TransactionsScanned bool
+	// Paused watches aren't checked until they're resumed
+	Paused bool
+	WatchSettings
 }
 
 // GetIdentifier returns the pubkey of the PubkeyInfo variable
@@ -31,10 +41,41 @@ func (p PubkeyInfo) GetNickname() string {
 	return p.Nickname
 }
 
+// BalanceEvent returns a BalanceEvent describing the PubkeyInfo variable
+func (p PubkeyInfo) BalanceEvent() BalanceEvent {
+	kind := KindPubkey
+	if IsDescriptor(p.Pubkey) {
+		kind = KindDescriptor
+	}
+	return BalanceEvent{
+		Type:                    EventBalanceChanged,
+		Priority:                PriorityNormal,
+		Network:                 chainParams.Name,
+		Kind:                    kind,
+		Identifier:              p.Pubkey,
+		Nickname:                p.Nickname,
+		BalanceSat:              p.BalanceSat,
+		ConfirmedBalanceSat:     p.ConfirmedBalanceSat,
+		PendingBalanceSat:       p.PendingBalanceSat,
+		SpendableBalanceSat:     p.SpendableBalanceSat,
+		PreviousBalanceSat:      p.PreviousBalanceSat,
+		Currency:                p.Currency,
+		BalanceCurrency:         p.BalanceCurrency,
+		PreviousBalanceCurrency: p.PreviousBalanceCurrency,
+		TXCount:                 p.TXCount,
+		Notifiers:               p.Notifiers,
+		Template:                p.Template,
+		Time:                    time.Now(),
+	}
+}
+
 // Update updates the database with the PubkeyInfo variable
 func (p PubkeyInfo) Update(w Watcher) error {
 	tx := w.DB.Model(&PubkeyInfo{}).
 		Where(&PubkeyInfo{Pubkey: p.Pubkey, Nickname: p.Nickname}).
+		// Select all columns so balances going to zero are saved, but leave
+		// out the ones checks don't change
+		Select("*").Omit(checkOmittedColumns...).
 		Updates(&p)
 	if tx.RowsAffected != 1 {
 		return fmt.Errorf("%d rows affected", tx.RowsAffected)
@@ -43,152 +84,118 @@ func (p PubkeyInfo) Update(w Watcher) error {
 }
 
 const (
-	pubkeyMessageTemplate = `**Pubkey Balance Changed**
+	pubkeyMessageTemplate = `**{{ .Title }}**
 Nickname: {{ .Nickname }}
-Address: {{ .Pubkey }}
+Address: {{ .Identifier }}
 Previous Balance (satoshis): {{ .PreviousBalanceSat }}
 Previous Balance ({{ .Currency }}): {{ .PreviousBalanceCurrency }}
 Transactions: {{ .TXCount }}
 New Balance (satoshis): {{ .BalanceSat }}
 New Balance ({{ .Currency }}): {{ .BalanceCurrency }}
-`
+{{ if .PendingBalanceSat }}Confirmed Balance (satoshis): {{ .ConfirmedBalanceSat }}
+Pending Balance (satoshis): {{ .PendingBalanceSat }}
+{{ end }}{{ if ne .SpendableBalanceSat .BalanceSat }}Spendable Balance (satoshis): {{ .SpendableBalanceSat }}
+{{ end }}{{ range .Transactions }}Transaction: {{ .TXID }}
+  {{ .Direction }} {{ .NetSat }} sats, fee {{ .FeeSat }} sats, {{ .Status }}
+{{ if .DustSat }}  including {{ .DustSat }} sats of dust
+{{ end }}{{ end }}`
 )
 
-// WatchPubkey takes a btcapi config and a nickname:pubkey string. It
-// checks the database for a previous pubkey summary and compares the
-// previous balance to the current balance. If they are different,
-// it calls Watcher.SendNotification.
-func (w Watcher) WatchPubkey(stop chan bool, pubkey string) {
-main:
-	for {
-		select {
-		case <-stop:
-			break main
-		default:
-			nickname := w.GetNickname(pubkey)
-			var pubKeys []string
-			pubKeys = append(pubKeys, pubkey)
-			oldPubkeyInfo := w.GetPubkeyInfo(pubKeys[0])
-			// Insert a blank PubkeyInfo if none was found
-			if (oldPubkeyInfo == PubkeyInfo{}) {
-				var err error
-				oldPubkeyInfo, err = w.CreateNewPubkeyInfo(pubKeys[0], nickname)
-				if err != nil {
-					log.Error(err)
-					return
-				}
-			}
-
-			pubkeySummary, err := w.BTCAPI.ExtendedPublicKeyDetails(pubKeys[0])
-			if err != nil {
-				log.Errorf("error calling btcapi: %v", err)
-				continue
-			}
-
-			if w.CheckAllPubkeyTypes {
-				for _, pubkeyType := range pubkeySummary.RelatedKeys {
-					pubKeys = append(pubKeys, pubkeyType.Key)
-				}
-			}
-
-			// totalBalance is the balance of all pubkeys, similar for totalTxCount.
-			totalBalance, totalTxCount := 0, 0
-			for _, pubkey := range pubKeys {
-				// totalPubkeyBalance is the balance for this pubkey, similar
-				// for totalPubkeyTxCount. NoTXCount is incremented when
-				// a consecutive address check yields no new transactions.
-				totalPubkeyBalance, totalPubkeyTxCount, NoTXCount := 0, 0, 0
-
-			pubkey:
-				for offset := 0; 0 == 0; offset = offset + w.PageSize {
-					pubKeyPage, err := w.BTCAPI.ExtendedPublicKeyDetailsPage(pubkey, w.PageSize, offset)
-					if err != nil {
-						log.Errorf("error calling btcapi: %v", err)
-					}
-
-					// pubkeyTxCount is used to keep track of how many addresses
-					// we find that don't have new transactions.
-					pubkeyTxCount := 0
-					addresses := []string{}
-
-					// Zipper join addresses.
-					// ChangeAddresses and ReceiveAddresses should be the same length.
-					for i := 0; i < len(pubKeyPage.ChangeAddresses); i++ {
-						addresses = append(addresses, pubKeyPage.ReceiveAddresses[i], pubKeyPage.ChangeAddresses[i])
-					}
-					for _, address := range addresses {
-						// Check if we've received a stop message
-						select {
-						case <-stop:
-							break main
-						default:
-							log.Debug("checking address: " + address)
-							addressSummary, err := w.UpdatePubkeysTotal(address, &totalPubkeyBalance, &totalPubkeyTxCount)
-							if err != nil {
-								log.Errorf("error updating pubkey total: %v", err)
-								continue
-							}
-							if pubkeyTxCount == addressSummary.TXHistory.TXCount {
-								if NoTXCount > w.Lookahead*2 {
-									// Stop paging, we haven't had an address with
-									// transactions in w.Lookahead * 2 addresses.
-									// (we multiply by 2 because we're checking
-									// both receive and change addresses)
-									break pubkey
-								}
-								NoTXCount++
-							}
-							// Set the pubkeyTxCount so we can compare it next run to
-							// monitor if we're seeing activity on the addresses
-							// we're scanning.
-							pubkeyTxCount = addressSummary.TXHistory.TXCount
-						}
-					}
-				}
-
-				// We're done checking this pubkey, add the balance to
-				// the totals. If w.CheckAllPubkeyTypes is on, we
-				// might check other pubkeys after this.
-				totalBalance = totalBalance + totalPubkeyBalance
-				totalTxCount = totalTxCount + totalPubkeyTxCount
-			}
-
-			currencyBalance, err := w.ConvertBalance(oldPubkeyInfo.Currency, totalBalance)
-			if err != nil || currencyBalance == nil {
-				log.Errorf("unable to convert balance of %d to %s, err: %v", totalBalance, w.Currency, err)
-				currencyBalance[0] = "0.00"
-			}
-			pubkeyInfo := PubkeyInfo{
-				Pubkey:                  pubKeys[0],
-				Nickname:                nickname,
-				BalanceSat:              totalBalance,
-				BalanceCurrency:         currencyBalance[0],
-				Currency:                oldPubkeyInfo.Currency,
-				PreviousBalanceSat:      oldPubkeyInfo.BalanceSat,
-				PreviousBalanceCurrency: oldPubkeyInfo.BalanceCurrency,
-				TXCount:                 totalTxCount,
-			}
-			if pubkeyInfo.BalanceSat != oldPubkeyInfo.BalanceSat {
-				log.Infof("\"%s\" (%s) balance updated from %d to %d sats", nickname, pubKeys[0], oldPubkeyInfo.BalanceSat, pubkeyInfo.BalanceSat)
-				w.UpdateInfo(pubkeyInfo)
-				w.SendNotification(pubkeyInfo, pubkeyMessageTemplate)
-			}
-			// Check every second for a stop signal
-			for i := 0; i < w.SleepInterval; i++ {
-				select {
-				case <-stop:
-					break main
-				default:
-					time.Sleep(time.Second)
-				}
-			}
+// CheckPubkey checks the database for a previous pubkey summary and
+// compares the previous balance and transactions to the current ones.
+// If they are different, it calls Watcher.ReportChanges. Nothing is
+// saved or reported if ctx is cancelled, since the pubkey may have been
+// removed. If mempoolOnly is
+// true, only new transactions are looked for (see CheckTransactions), and
+// only MempoolLookahead addresses after the last used one are checked.
+func (w Watcher) CheckPubkey(ctx context.Context, pubkey string, mempoolOnly bool) error {
+	nickname := w.GetNickname(pubkey)
+	var pubKeys []string
+	pubKeys = append(pubKeys, pubkey)
+	oldPubkeyInfo := w.GetPubkeyInfo(ctx, pubKeys[0])
+	// The information is saved when the pubkey is added, so
+	// it's missing if the pubkey was removed since
+	if (oldPubkeyInfo == PubkeyInfo{}) {
+		return fmt.Errorf("no information saved for pubkey %s", pubKeys[0])
+	}
+
+	if w.CheckAllPubkeyTypes {
+		relatedKeys, err := RelatedExtendedKeys(pubKeys[0])
+		if err != nil {
+			return fmt.Errorf("unable to find the other types of %s: %w", pubKeys[0], err)
 		}
+		pubKeys = append(pubKeys, relatedKeys...)
 	}
+
+	// New mempool transactions are almost always to a used address or
+	// the next one, so the rest of the lookahead waits for a full check
+	lookahead := w.Lookahead
+	if mempoolOnly {
+		lookahead = MempoolLookahead
+	}
+
+	// totalBalance is the balance of all pubkeys, similar for totalTxCount.
+	totalBalance, totalTxCount := 0, 0
+	// usedSummaries holds the summaries of addresses with transactions
+	usedSummaries := []btcapi.AddressSummary{}
+	for _, pubkey := range pubKeys {
+		scan, err := w.ScanPubkey(ctx, pubKeys[0], pubkey, lookahead)
+		if ctx.Err() != nil {
+			log.Debugf("stopped checking %s", pubKeys[0])
+			return nil
+		}
+		// The scan isn't complete, so nothing is saved or reported
+		if err != nil {
+			return fmt.Errorf("unable to check addresses of %s: %w", pubkey, err)
+		}
+		// If w.CheckAllPubkeyTypes is on, we might
+		// check other pubkeys after this.
+		totalBalance = totalBalance + scan.BalanceSat
+		totalTxCount = totalTxCount + scan.TXCount
+		usedSummaries = append(usedSummaries, scan.UsedSummaries...)
+	}
+
+	balanceCurrency := "0.00"
+	currencyBalance, err := w.ConvertBalance(ctx, oldPubkeyInfo.Currency, totalBalance)
+	if err != nil || currencyBalance == nil {
+		log.Errorf("unable to convert balance of %d to %s, err: %v", totalBalance, w.Currency, err)
+	} else {
+		balanceCurrency = currencyBalance[0]
+	}
+	pubkeyInfo := PubkeyInfo{
+		Pubkey:                  pubKeys[0],
+		Nickname:                nickname,
+		BalanceSat:              totalBalance,
+		BalanceCurrency:         balanceCurrency,
+		Currency:                oldPubkeyInfo.Currency,
+		PreviousBalanceSat:      oldPubkeyInfo.BalanceSat,
+		PreviousBalanceCurrency: oldPubkeyInfo.BalanceCurrency,
+		TXCount:                 totalTxCount,
+		TransactionsScanned:     true,
+		WatchSettings:           oldPubkeyInfo.WatchSettings,
+	}
+	// Keep the previous balance if only the confirmation status changed
+	if pubkeyInfo.BalanceSat == oldPubkeyInfo.BalanceSat {
+		pubkeyInfo.PreviousBalanceSat = oldPubkeyInfo.PreviousBalanceSat
+		pubkeyInfo.PreviousBalanceCurrency = oldPubkeyInfo.PreviousBalanceCurrency
+	}
+
+	changes := w.CheckTransactions(ctx, pubKeys[0], usedSummaries, !oldPubkeyInfo.TransactionsScanned, oldPubkeyInfo.WatchSettings, mempoolOnly)
+	pubkeyInfo.PendingBalanceSat = w.PendingBalance(pubKeys[0])
+	pubkeyInfo.ConfirmedBalanceSat = pubkeyInfo.BalanceSat - pubkeyInfo.PendingBalanceSat
+	pubkeyInfo.SpendableBalanceSat = pubkeyInfo.BalanceSat - w.DustBalance(pubKeys[0])
+
+	if ctx.Err() != nil {
+		log.Debugf("stopped checking %s", pubKeys[0])
+		return nil
+	}
+	w.ReportChanges(ctx, oldPubkeyInfo, pubkeyInfo, !oldPubkeyInfo.TransactionsScanned, changes)
+	return nil
 }
 
 // CreateNewPubkeyInfo reates an PubkeyInfo database entry for a new
-// pubkey & nickname combination.
-func (w Watcher) CreateNewPubkeyInfo(pubkey string, nickname string) (PubkeyInfo, error) {
+// pubkey & nickname combination with the provided settings.
+func (w Watcher) CreateNewPubkeyInfo(pubkey string, nickname string, settings WatchSettings) (PubkeyInfo, error) {
 	log.Warnf("previous pubkey information for \"%s\" (%s) was not found, database will be updated", nickname, pubkey)
 	pubkeyInfo := PubkeyInfo{
 		Pubkey:                  pubkey,
@@ -199,6 +206,7 @@ func (w Watcher) CreateNewPubkeyInfo(pubkey string, nickname string) (PubkeyInfo
 		PreviousBalanceSat:      0,
 		PreviousBalanceCurrency: "0.00",
 		TXCount:                 0,
+		WatchSettings:           settings,
 	}
 	tx := w.DB.Model(&PubkeyInfo{}).Create(&pubkeyInfo)
 	if tx.RowsAffected != 1 {
@@ -207,26 +215,14 @@ func (w Watcher) CreateNewPubkeyInfo(pubkey string, nickname string) (PubkeyInfo
 	return pubkeyInfo, nil
 }
 
-// UpdatePubkeysTotal takes an address and updates the totals of the pointers provided
-// and returns the addressSummary.
-func (w Watcher) UpdatePubkeysTotal(address string, totalPubkeyBalance *int, totalPubkeyTxCount *int) (btcapi.AddressSummary, error) {
-	addressSummary, err := w.BTCAPI.AddressSummary(address)
-	if err != nil {
-		return addressSummary, err
-	}
-	*totalPubkeyBalance = *totalPubkeyBalance + addressSummary.TXHistory.BalanceSat
-	*totalPubkeyTxCount = *totalPubkeyTxCount + addressSummary.TXHistory.TXCount
-	return addressSummary, nil
-}
-
 // GetPubkeyInfo gets a PubkeyInfo object from the database identified by a pubkey
-func (w Watcher) GetPubkeyInfo(pubkey string) (p PubkeyInfo) {
+func (w Watcher) GetPubkeyInfo(ctx context.Context, pubkey string) (p PubkeyInfo) {
 	w.DB.Model(&PubkeyInfo{}).
 		Where(&PubkeyInfo{Pubkey: pubkey}).
 		Scan(&p)
 	// Update the object with current exchange rates
 	if (p != PubkeyInfo{}) {
-		bs, err := w.ConvertBalance(p.Currency, p.PreviousBalanceSat, p.BalanceSat)
+		bs, err := w.ConvertBalance(ctx, p.Currency, p.PreviousBalanceSat, p.BalanceSat)
 		if err != nil || bs == nil {
 			log.Errorf("error converting balance, err: %v", err)
 			return p
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultRequestsPerSecond int = 10
+	DefaultScanWorkers       int = 4
+)
+
+// RateLimiter spaces out requests evenly
+type RateLimiter struct {
+	ticker *time.Ticker
+}
+
+// NewRateLimiter returns a RateLimiter that allows
+// requestsPerSecond requests every second
+func NewRateLimiter(requestsPerSecond int) *RateLimiter {
+	// Rates above one request per nanosecond round down to no
+	// interval at all, which time.NewTicker doesn't allow
+	interval := time.Second / time.Duration(requestsPerSecond)
+	if interval <= 0 {
+		interval = time.Nanosecond
+	}
+	return &RateLimiter{ticker: time.NewTicker(interval)}
+}
+
+// Wait blocks until the next request is allowed or ctx is done
+func (r *RateLimiter) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.ticker.C:
+		return nil
+	}
+}
+
+// rateLimitedTransport is an http.RoundTripper that
+// waits for a rate limiter before every request
+type rateLimitedTransport struct {
+	limiter *RateLimiter
+	next    http.RoundTripper
+}
+
+// RoundTrip waits for the rate limiter, unless the
+// request is cancelled first
+func (t rateLimitedTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(r.Context()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(r)
+}
+
+// NewExplorer returns the client of BTC_RPC_API. Its requests are
+// limited to REQUESTS_PER_SECOND, shared by every watch, while other
+// requests (like the ones to notifiers) aren't limited.
+func (w Watcher) NewExplorer() Explorer {
+	client := &http.Client{Timeout: ExplorerTimeout}
+	if w.RequestsPerSecond > 0 {
+		client.Transport = rateLimitedTransport{
+			limiter: NewRateLimiter(w.RequestsPerSecond),
+			next:    http.DefaultTransport,
+		}
+	}
+	return Explorer{URL: w.BTCAPIEndpoint, Client: client}
+}
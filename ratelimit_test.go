@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWaitCancelled(t *testing.T) {
+	limiter := NewRateLimiter(1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+	if waited := time.Since(start); waited > 500*time.Millisecond {
+		t.Errorf("waited %v for a cancelled request", waited)
+	}
+}
+
+func TestNewRateLimiterHighRate(t *testing.T) {
+	limiter := NewRateLimiter(2000000000)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewExplorerOnlyLimitsExplorer(t *testing.T) {
+	transport := http.DefaultTransport
+	w := Watcher{}
+	w.RequestsPerSecond = 100
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("700000"))
+	}))
+	defer server.Close()
+	w.BTCAPIEndpoint = server.URL
+
+	e := w.NewExplorer()
+	if http.DefaultTransport != transport {
+		t.Error("http.DefaultTransport was replaced")
+	}
+	if _, ok := e.Client.Transport.(rateLimitedTransport); !ok {
+		t.Error("explorer requests aren't rate limited")
+	}
+	if height, err := e.TipHeight(context.Background()); err != nil || height != 700000 {
+		t.Errorf("got %d, %v", height, err)
+	}
+}
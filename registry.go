@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// watchEntry is a watched identifier and the cancel function
+// of the context its checks run with
+type watchEntry struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// WatchRegistry holds the watched identifiers (addresses and pubkeys)
+// and is safe to use from the API handlers and the checks at once.
+// The contexts of the watches aren't derived from the shutdown signal,
+// so running checks can finish while shutting down.
+type WatchRegistry struct {
+	lock      sync.RWMutex
+	base      context.Context
+	cancelAll context.CancelFunc
+	watches   map[string]watchEntry
+}
+
+// NewWatchRegistry returns an empty WatchRegistry
+func NewWatchRegistry() *WatchRegistry {
+	base, cancel := context.WithCancel(context.Background())
+	return &WatchRegistry{
+		base:      base,
+		cancelAll: cancel,
+		watches:   map[string]watchEntry{},
+	}
+}
+
+// Add registers an identifier. It returns false if it's already registered.
+func (r *WatchRegistry) Add(identifier string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.watches[identifier]; ok {
+		return false
+	}
+	ctx, cancel := context.WithCancel(r.base)
+	r.watches[identifier] = watchEntry{ctx: ctx, cancel: cancel}
+	return true
+}
+
+// Remove unregisters an identifier, stopping a check of it that's running
+func (r *WatchRegistry) Remove(identifier string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if e, ok := r.watches[identifier]; ok {
+		e.cancel()
+		delete(r.watches, identifier)
+	}
+}
+
+// Context returns the context to check an identifier with,
+// and false if it isn't registered
+func (r *WatchRegistry) Context(identifier string) (context.Context, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	e, ok := r.watches[identifier]
+	return e.ctx, ok
+}
+
+// Identifiers returns the registered identifiers, sorted
+func (r *WatchRegistry) Identifiers() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	identifiers := make([]string, 0, len(r.watches))
+	for id := range r.watches {
+		identifiers = append(identifiers, id)
+	}
+	sort.Strings(identifiers)
+	return identifiers
+}
+
+// CancelAll stops the running checks of every identifier
+func (r *WatchRegistry) CancelAll() {
+	r.cancelAll()
+}
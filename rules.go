@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// RuleBalanceAbove matches when the balance rises to or above Value sats
+	RuleBalanceAbove string = "balance_above"
+	// RuleBalanceBelow matches when the balance drops below Value sats
+	RuleBalanceBelow string = "balance_below"
+	// RuleFiatAbove matches when the balance rises to or above
+	// Value in the watch's currency
+	RuleFiatAbove string = "fiat_above"
+	// RuleFiatBelow matches when the balance drops below Value
+	// in the watch's currency
+	RuleFiatBelow string = "fiat_below"
+	// RuleChangeSats matches when the balance changes by at least Value sats
+	RuleChangeSats string = "change_sats"
+	// RuleChangePercent matches when the balance changes by at
+	// least Value percent of the previous balance
+	RuleChangePercent string = "change_percent"
+	// RuleOutgoing matches any outgoing spend. Value is ignored.
+	RuleOutgoing string = "outgoing"
+)
+
+// alertRuleTypes holds every rule type that can be saved
+var alertRuleTypes = map[string]bool{
+	RuleBalanceAbove:  true,
+	RuleBalanceBelow:  true,
+	RuleFiatAbove:     true,
+	RuleFiatBelow:     true,
+	RuleChangeSats:    true,
+	RuleChangePercent: true,
+	RuleOutgoing:      true,
+}
+
+// AlertRule is a condition a balance change of a watched identifier
+// (address or pubkey) has to meet to be notified. Watches without
+// rules are notified of every balance change.
+type AlertRule struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Identifier string    `gorm:"index" json:"identifier"`
+	Type       string    `json:"type"`
+	Value      float64   `json:"value"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// AlertRulePOST is used to save or delete an AlertRule
+type AlertRulePOST struct {
+	ID         uint    `json:"id"`
+	Identifier string  `json:"identifier"`
+	Type       string  `json:"type"`
+	Value      float64 `json:"value"`
+}
+
+// AlertRuleResponse is the response from a
+// SaveRule request
+type AlertRuleResponse struct {
+	Errors string     `json:"errors,omitempty"`
+	Rule   *AlertRule `json:"rule,omitempty"`
+}
+
+// Validate returns an error if the rule can never match
+func (r AlertRule) Validate() error {
+	if !alertRuleTypes[r.Type] {
+		return fmt.Errorf("unknown rule type \"%s\"", r.Type)
+	}
+	if r.Type != RuleOutgoing && r.Value <= 0 {
+		return fmt.Errorf("rule \"%s\" needs a value greater than 0", r.Type)
+	}
+	return nil
+}
+
+// Matches returns whether a balance change meets the rule. price is
+// the price of a bitcoin in the event's currency, used by fiat rules.
+func (r AlertRule) Matches(e BalanceEvent, price float64) bool {
+	previous, current := float64(e.PreviousBalanceSat), float64(e.BalanceSat)
+	switch r.Type {
+	case RuleBalanceAbove:
+		return previous < r.Value && current >= r.Value
+	case RuleBalanceBelow:
+		return previous >= r.Value && current < r.Value
+	case RuleFiatAbove, RuleFiatBelow:
+		// The current price is used for both so only a change in
+		// balance, not in price, crosses the threshold
+		previous = previous * price / float64(SatsPerBitcoin)
+		current = current * price / float64(SatsPerBitcoin)
+		if r.Type == RuleFiatAbove {
+			return previous < r.Value && current >= r.Value
+		}
+		return previous >= r.Value && current < r.Value
+	case RuleChangeSats:
+		return math.Abs(current-previous) >= r.Value
+	case RuleChangePercent:
+		if previous == 0 {
+			return current != 0
+		}
+		return math.Abs(current-previous)*100/previous >= r.Value
+	case RuleOutgoing:
+		for _, t := range e.Transactions {
+			if t.Direction == DirectionOutgoing {
+				return true
+			}
+		}
+		return current < previous
+	}
+	return false
+}
+
+// GetAlertRules returns the rules of an identifier
+func (w Watcher) GetAlertRules(identifier string) (rules []AlertRule) {
+	w.DB.Model(&AlertRule{}).
+		Where(&AlertRule{Identifier: identifier}).
+		Order("id").
+		Find(&rules)
+	return rules
+}
+
+// MatchAlertRules returns whether a balance change should be notified,
+// which is when the watch has no rules or any of its rules match
+func (w Watcher) MatchAlertRules(ctx context.Context, e BalanceEvent) bool {
+	rules := w.GetAlertRules(e.Identifier)
+	if len(rules) == 0 {
+		return true
+	}
+
+	price := 0.0
+	for _, r := range rules {
+		if (r.Type == RuleFiatAbove || r.Type == RuleFiatBelow) && price == 0 {
+			var err error
+			if price, err = w.Price(ctx, e.Currency); err != nil {
+				log.Errorf("unable to get price for rules of \"%s\" (%s): %v", e.Nickname, e.Identifier, err)
+				continue
+			}
+		}
+		if r.Matches(e, price) {
+			log.Debugf("rule %d (%s %v) matched for \"%s\" (%s)", r.ID, r.Type, r.Value, e.Nickname, e.Identifier)
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteAlertRules deletes all rules for an identifier
+func (w Watcher) DeleteAlertRules(identifier string) {
+	w.DB.Where(&AlertRule{Identifier: identifier}).Delete(&AlertRule{})
+}
+
+// GetRules returns the alert rules of the identifier in the identifier
+// query parameter, or every rule if it isn't set
+func (w Watcher) GetRules(c *gin.Context) {
+	rules := []AlertRule{}
+	tx := w.DB.Model(&AlertRule{})
+	if identifier := c.Query("identifier"); identifier != "" {
+		tx = tx.Where(&AlertRule{Identifier: NormalizeIdentifier(identifier)})
+	}
+	tx.Order("id").Find(&rules)
+	c.JSON(http.StatusOK, rules)
+}
+
+// SaveRule adds an alert rule to a watched identifier
+func (w Watcher) SaveRule(c *gin.Context) {
+	status := http.StatusCreated
+	body, _ := ioutil.ReadAll(c.Request.Body)
+	var req AlertRulePOST
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusInternalServerError, AlertRuleResponse{
+			Errors: fmt.Sprint(err),
+		})
+		return
+	}
+
+	req.Identifier = NormalizeIdentifier(req.Identifier)
+	response := AlertRuleResponse{}
+	if !w.IsWatched(req.Identifier) {
+		status = http.StatusNotFound
+		response.Errors = "Identifier is not being watched"
+		c.JSON(status, response)
+		return
+	}
+	r := AlertRule{
+		Identifier: req.Identifier,
+		Type:       req.Type,
+		Value:      req.Value,
+	}
+	if err := r.Validate(); err != nil {
+		status = http.StatusBadRequest
+		response.Errors = fmt.Sprint(err)
+		c.JSON(status, response)
+		return
+	}
+
+	if tx := w.DB.Create(&r); tx.Error != nil {
+		status = http.StatusInternalServerError
+		response.Errors = fmt.Sprint(tx.Error)
+	} else {
+		response.Rule = &r
+	}
+	c.JSON(status, response)
+}
+
+// DeleteRule deletes an alert rule by its ID
+func (w Watcher) DeleteRule(c *gin.Context) {
+	body, _ := ioutil.ReadAll(c.Request.Body)
+	var req AlertRulePOST
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusInternalServerError, AlertRuleResponse{
+			Errors: fmt.Sprint(err),
+		})
+		return
+	}
+
+	status := http.StatusOK
+	tx := w.DB.Delete(&AlertRule{}, req.ID)
+	c.JSON(status, tx.RowsAffected == 1)
+}
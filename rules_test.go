@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAlertRuleMatches(t *testing.T) {
+	outgoing := []WatchedTransaction{{Direction: DirectionOutgoing}}
+	incoming := []WatchedTransaction{{Direction: DirectionIncoming}}
+	tests := []struct {
+		name         string
+		rule         AlertRule
+		previous     int
+		current      int
+		transactions []WatchedTransaction
+		price        float64
+		want         bool
+	}{
+		{"balance above crossed", AlertRule{Type: RuleBalanceAbove, Value: 1000}, 500, 1500, nil, 0, true},
+		{"balance above reached exactly", AlertRule{Type: RuleBalanceAbove, Value: 1000}, 500, 1000, nil, 0, true},
+		{"balance above already above", AlertRule{Type: RuleBalanceAbove, Value: 1000}, 1000, 2000, nil, 0, false},
+		{"balance above not reached", AlertRule{Type: RuleBalanceAbove, Value: 1000}, 500, 999, nil, 0, false},
+		{"balance below crossed", AlertRule{Type: RuleBalanceBelow, Value: 1000}, 1500, 500, nil, 0, true},
+		{"balance below from exactly", AlertRule{Type: RuleBalanceBelow, Value: 1000}, 1000, 999, nil, 0, true},
+		{"balance below reached exactly", AlertRule{Type: RuleBalanceBelow, Value: 1000}, 1500, 1000, nil, 0, false},
+		{"balance below already below", AlertRule{Type: RuleBalanceBelow, Value: 1000}, 500, 100, nil, 0, false},
+		// At 20000 per bitcoin, 100000 sats are worth 20
+		{"fiat above crossed", AlertRule{Type: RuleFiatAbove, Value: 20}, 50000, 100000, nil, 20000, true},
+		{"fiat above not reached", AlertRule{Type: RuleFiatAbove, Value: 20}, 50000, 99999, nil, 20000, false},
+		{"fiat above without a price", AlertRule{Type: RuleFiatAbove, Value: 20}, 50000, 100000, nil, 0, false},
+		{"fiat below crossed", AlertRule{Type: RuleFiatBelow, Value: 20}, 100000, 99999, nil, 20000, true},
+		{"fiat below reached exactly", AlertRule{Type: RuleFiatBelow, Value: 20}, 200000, 100000, nil, 20000, false},
+		{"change sats increase", AlertRule{Type: RuleChangeSats, Value: 500}, 1000, 1500, nil, 0, true},
+		{"change sats decrease", AlertRule{Type: RuleChangeSats, Value: 500}, 1500, 1000, nil, 0, true},
+		{"change sats too small", AlertRule{Type: RuleChangeSats, Value: 500}, 1000, 1499, nil, 0, false},
+		{"change percent reached exactly", AlertRule{Type: RuleChangePercent, Value: 10}, 1000, 1100, nil, 0, true},
+		{"change percent decrease", AlertRule{Type: RuleChangePercent, Value: 10}, 1000, 800, nil, 0, true},
+		{"change percent too small", AlertRule{Type: RuleChangePercent, Value: 10}, 1000, 1099, nil, 0, false},
+		{"change percent from nothing", AlertRule{Type: RuleChangePercent, Value: 10}, 0, 1, nil, 0, true},
+		{"change percent staying at nothing", AlertRule{Type: RuleChangePercent, Value: 10}, 0, 0, nil, 0, false},
+		{"outgoing transaction", AlertRule{Type: RuleOutgoing}, 1000, 2000, outgoing, 0, true},
+		{"outgoing without transactions", AlertRule{Type: RuleOutgoing}, 2000, 1000, nil, 0, true},
+		{"incoming without transactions", AlertRule{Type: RuleOutgoing}, 1000, 2000, nil, 0, false},
+		{"incoming transaction", AlertRule{Type: RuleOutgoing}, 1000, 2000, incoming, 0, false},
+		{"unknown type", AlertRule{Type: "unknown", Value: 1}, 0, 1000, nil, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := BalanceEvent{
+				PreviousBalanceSat: test.previous,
+				BalanceSat:         test.current,
+				Transactions:       test.transactions,
+			}
+			if got := test.rule.Matches(e, test.price); got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchAlertRulesWithoutPrice(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	w := Watcher{DB: newTestDB(t), Explorer: Explorer{URL: server.URL, Client: server.Client()}}
+	e := BalanceEvent{Identifier: "bc1q", PreviousBalanceSat: 0, BalanceSat: 200000000, Currency: CurrencyUSD}
+
+	if !w.MatchAlertRules(context.Background(), e) {
+		t.Error("a watch without rules wasn't notified")
+	}
+	// A fiat rule can't match when the price isn't known
+	w.DB.Create(&AlertRule{Identifier: "bc1q", Type: RuleFiatAbove, Value: 1})
+	if w.MatchAlertRules(context.Background(), e) {
+		t.Error("fiat rule matched without a price")
+	}
+	// but the other rules are still checked
+	w.DB.Create(&AlertRule{Identifier: "bc1q", Type: RuleBalanceAbove, Value: 1000})
+	if !w.MatchAlertRules(context.Background(), e) {
+		t.Error("balance rule didn't match after a fiat rule without a price")
+	}
+}
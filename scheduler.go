@@ -0,0 +1,305 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultMaxConcurrentChecks int = 4
+)
+
+// scheduledCheck is the next check of a watched identifier
+// (address or pubkey)
+type scheduledCheck struct {
+	Identifier string
+	Due        time.Time
+	// index is the position of the check in the queue,
+	// or -1 while the check is running
+	index int
+	// runAgain is set when RunNow is called while the check is running
+	runAgain bool
+	// removed is set when Remove is called while the check is running
+	removed bool
+}
+
+// checkQueue is a heap of scheduled checks ordered by when they're due
+type checkQueue []*scheduledCheck
+
+func (q checkQueue) Len() int           { return len(q) }
+func (q checkQueue) Less(i, j int) bool { return q[i].Due.Before(q[j].Due) }
+func (q checkQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *checkQueue) Push(x interface{}) {
+	c := x.(*scheduledCheck)
+	c.index = len(*q)
+	*q = append(*q, c)
+}
+
+func (q *checkQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	old[len(old)-1] = nil
+	c.index = -1
+	*q = old[:len(old)-1]
+	return c
+}
+
+// Scheduler runs the checks of every watch from a single queue, so
+// no more than MAX_CONCURRENT_CHECKS run at once. After a check, the
+// watch is scheduled again after its interval plus up to SLEEP_JITTER
+// seconds, which spreads checks out over time.
+type Scheduler struct {
+	lock   sync.Mutex
+	queue  checkQueue
+	checks map[string]*scheduledCheck
+	// wake is signaled when the first check in the queue changes
+	wake chan bool
+	// slots limits how many checks run at once
+	slots chan bool
+	// running counts the checks that are running
+	running  sync.WaitGroup
+	jitter   time.Duration
+	check    func(identifier string)
+	interval func(identifier string) time.Duration
+}
+
+// NewScheduler returns a Scheduler that calls check for each watch
+// every interval(identifier)
+func NewScheduler(maxConcurrent int, jitter time.Duration, check func(string), interval func(string) time.Duration) *Scheduler {
+	return &Scheduler{
+		checks:   map[string]*scheduledCheck{},
+		wake:     make(chan bool, 1),
+		slots:    make(chan bool, maxConcurrent),
+		jitter:   jitter,
+		check:    check,
+		interval: interval,
+	}
+}
+
+// Jitter returns a random delay of up to SLEEP_JITTER
+func (s *Scheduler) Jitter() time.Duration {
+	if s.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(s.jitter)))
+}
+
+// Schedule adds a watch to the queue, or moves its next check, to run at due
+func (s *Scheduler) Schedule(identifier string, due time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, ok := s.checks[identifier]
+	switch {
+	case !ok:
+		c = &scheduledCheck{Identifier: identifier, Due: due}
+		s.checks[identifier] = c
+		heap.Push(&s.queue, c)
+	case c.index < 0:
+		// It's running, schedule it again when it's done
+		c.runAgain = true
+		c.removed = false
+		return
+	default:
+		c.Due = due
+		heap.Fix(&s.queue, c.index)
+	}
+	s.signal()
+}
+
+// RunNow moves the next check of a watch to now. It
+// returns false if the watch isn't scheduled.
+func (s *Scheduler) RunNow(identifier string) bool {
+	s.lock.Lock()
+	c, ok := s.checks[identifier]
+	ok = ok && !c.removed
+	s.lock.Unlock()
+	if ok {
+		s.Schedule(identifier, time.Now())
+	}
+	return ok
+}
+
+// RunAll moves the next check of every watch to now
+func (s *Scheduler) RunAll() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	for _, c := range s.checks {
+		if c.index < 0 {
+			c.runAgain = !c.removed
+			continue
+		}
+		c.Due = now
+	}
+	heap.Init(&s.queue)
+	s.signal()
+}
+
+// Remove stops scheduling checks of a watch. A check that is
+// already running isn't interrupted, and if the watch is scheduled
+// again before it finishes, it runs again after it.
+func (s *Scheduler) Remove(identifier string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, ok := s.checks[identifier]
+	if !ok {
+		return
+	}
+	if c.index < 0 {
+		c.removed = true
+		c.runAgain = false
+		return
+	}
+	delete(s.checks, identifier)
+	heap.Remove(&s.queue, c.index)
+	s.signal()
+}
+
+// signal wakes up Run. s.lock must be held.
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- true:
+	default:
+	}
+}
+
+// Run starts checks as they become due until ctx is done. Checks
+// that are running when it returns are left to finish, see Wait.
+func (s *Scheduler) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	for {
+		s.lock.Lock()
+		wait := time.Hour
+		if len(s.queue) > 0 {
+			wait = time.Until(s.queue[0].Due)
+		}
+		s.lock.Unlock()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+			continue
+		case <-timer.C:
+		}
+
+		// Wait for a free slot before taking the check off the queue,
+		// so RunNow and Schedule can still move it while waiting
+		select {
+		case <-ctx.Done():
+			return
+		case s.slots <- true:
+		}
+		s.lock.Lock()
+		if len(s.queue) == 0 || s.queue[0].Due.After(time.Now()) {
+			s.lock.Unlock()
+			<-s.slots
+			continue
+		}
+		c := heap.Pop(&s.queue).(*scheduledCheck)
+		s.lock.Unlock()
+
+		s.running.Add(1)
+		go func() {
+			defer s.running.Done()
+			defer func() { <-s.slots }()
+			log.Debugf("checking %s", c.Identifier)
+			s.check(c.Identifier)
+			s.reschedule(c)
+		}()
+	}
+}
+
+// Wait waits for the running checks to finish. It returns
+// ctx.Err() if ctx is done first.
+func (s *Scheduler) Wait(ctx context.Context) error {
+	done := make(chan bool)
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return nil
+	}
+}
+
+// reschedule puts a check back on the queue after it ran,
+// unless the watch was removed while it was running
+func (s *Scheduler) reschedule(c *scheduledCheck) {
+	interval := s.interval(c.Identifier)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if c.removed {
+		delete(s.checks, c.Identifier)
+		return
+	}
+	c.Due = time.Now().Add(interval + s.Jitter())
+	if c.runAgain {
+		c.Due = time.Now()
+		c.runAgain = false
+	}
+	heap.Push(&s.queue, c)
+	s.signal()
+}
+
+// CheckWatch checks an address or pubkey once. In the blocks poll
+// mode, it's only fully checked once per block, and only checked
+// for new mempool transactions otherwise.
+func (w Watcher) CheckWatch(identifier string) {
+	ctx, ok := w.Watches.Context(identifier)
+	if !ok {
+		// It was removed after the check was started
+		return
+	}
+	full, tip := true, ""
+	if w.Tip != nil {
+		full, tip = w.Tip.NeedsFullCheck(identifier)
+	}
+	var err error
+	if IsPubkey(identifier) {
+		err = w.CheckPubkey(ctx, identifier, !full)
+	} else {
+		err = w.CheckAddress(ctx, identifier, !full)
+	}
+	if err != nil {
+		log.Errorf("error checking \"%s\" (%s): %v", w.GetNickname(identifier), identifier, err)
+		return
+	}
+	if w.Tip != nil && full && ctx.Err() == nil {
+		w.Tip.FullCheckDone(identifier, tip)
+	}
+}
+
+// CheckInterval returns the time between checks of an identifier,
+// which is its Interval setting, or SLEEP_INTERVAL (MEMPOOL_INTERVAL
+// in the blocks poll mode)
+func (w Watcher) CheckInterval(identifier string) time.Duration {
+	interval := w.SleepInterval
+	if w.PollMode == PollModeBlocks {
+		interval = w.MempoolInterval
+	}
+	if s := w.GetWatchSettings(identifier); s.Interval > 0 {
+		interval = s.Interval
+	}
+	return time.Duration(interval) * time.Second
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckQueueOrder(t *testing.T) {
+	now := time.Now()
+	q := checkQueue{}
+	for _, c := range []struct {
+		identifier string
+		delay      time.Duration
+	}{{"c", 3}, {"a", 1}, {"d", 4}, {"b", 2}} {
+		heap.Push(&q, &scheduledCheck{Identifier: c.identifier, Due: now.Add(c.delay * time.Second)})
+	}
+	for i, c := range q {
+		if c.index != i {
+			t.Fatalf("%s has index %d at position %d", c.Identifier, c.index, i)
+		}
+	}
+
+	// Moving a check keeps the queue ordered
+	q[0].Due = now.Add(5 * time.Second)
+	heap.Fix(&q, 0)
+
+	got := ""
+	for q.Len() > 0 {
+		c := heap.Pop(&q).(*scheduledCheck)
+		if c.index != -1 {
+			t.Errorf("%s has index %d after it was popped", c.Identifier, c.index)
+		}
+		got = got + c.Identifier
+	}
+	if got != "bcda" {
+		t.Errorf("got %s, want bcda", got)
+	}
+}
+
+// runTestScheduler runs a Scheduler with one check at a time that
+// sends the identifiers it checks on the returned channel
+func runTestScheduler(t *testing.T, interval time.Duration) (*Scheduler, chan string) {
+	checked := make(chan string, 100)
+	s := NewScheduler(1, 0, func(identifier string) { checked <- identifier },
+		func(string) time.Duration { return interval })
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Run(ctx)
+	t.Cleanup(cancel)
+	return s, checked
+}
+
+// nextCheck returns the next identifier that was checked,
+// or "" if nothing is checked within wait
+func nextCheck(checked chan string, wait time.Duration) string {
+	select {
+	case identifier := <-checked:
+		return identifier
+	case <-time.After(wait):
+		return ""
+	}
+}
+
+func TestSchedulerOrder(t *testing.T) {
+	s, checked := runTestScheduler(t, time.Hour)
+	now := time.Now()
+	s.Schedule("b", now.Add(40*time.Millisecond))
+	s.Schedule("c", now.Add(80*time.Millisecond))
+	s.Schedule("a", now)
+
+	for _, want := range []string{"a", "b", "c"} {
+		if got := nextCheck(checked, time.Second); got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+	// Every check is scheduled again after the interval
+	time.Sleep(10 * time.Millisecond)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.queue) != 3 {
+		t.Fatalf("%d checks are scheduled, want 3", len(s.queue))
+	}
+	for _, c := range s.queue {
+		if time.Until(c.Due) < 59*time.Minute {
+			t.Errorf("%s is due in %s, want an hour", c.Identifier, time.Until(c.Due))
+		}
+	}
+}
+
+func TestSchedulerReschedule(t *testing.T) {
+	s, checked := runTestScheduler(t, 20*time.Millisecond)
+	s.Schedule("a", time.Now())
+	for i := 0; i < 3; i++ {
+		if got := nextCheck(checked, time.Second); got != "a" {
+			t.Fatalf("check %d: got %q, want a", i, got)
+		}
+	}
+
+	// Scheduling a watch again moves its next check
+	s.Schedule("b", time.Now().Add(time.Hour))
+	s.Schedule("b", time.Now())
+	for {
+		got := nextCheck(checked, time.Second)
+		if got == "b" {
+			break
+		}
+		if got != "a" {
+			t.Fatalf("got %q, want b", got)
+		}
+	}
+}
+
+func TestSchedulerRemove(t *testing.T) {
+	s, checked := runTestScheduler(t, 20*time.Millisecond)
+	s.Schedule("a", time.Now().Add(20*time.Millisecond))
+	s.Remove("a")
+	if got := nextCheck(checked, 100*time.Millisecond); got != "" {
+		t.Errorf("removed watch %s was checked", got)
+	}
+}
+
+func TestSchedulerRemoveWhileRunning(t *testing.T) {
+	started := make(chan bool)
+	release := make(chan bool)
+	checks := 0
+	s := NewScheduler(1, 0, func(string) {
+		checks++
+		started <- true
+		<-release
+	}, func(string) time.Duration { return 10 * time.Millisecond })
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	s.Schedule("a", time.Now())
+	<-started
+	// The running check isn't scheduled again once it's done
+	s.Remove("a")
+	release <- true
+	select {
+	case <-started:
+		t.Fatal("removed watch was checked again")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.checks) != 0 || len(s.queue) != 0 || checks != 1 {
+		t.Errorf("%d checks and %d queued after %d runs, want none after 1", len(s.checks), len(s.queue), checks)
+	}
+}
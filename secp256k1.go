@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+)
+
+// secp256k1 is the curve y² = x³ + 7 over the field of order P
+var secp256k1 = struct {
+	P, N, B, Gx, Gy *big.Int
+}{
+	P:  hexInt("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f"),
+	N:  hexInt("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141"),
+	B:  big.NewInt(7),
+	Gx: hexInt("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"),
+	Gy: hexInt("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"),
+}
+
+// hexInt parses a hex constant
+func hexInt(s string) *big.Int {
+	i, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("invalid hex constant " + s)
+	}
+	return i
+}
+
+// Point is an affine point on secp256k1. The point
+// at infinity has a nil X.
+type Point struct {
+	X, Y *big.Int
+}
+
+// IsInfinity returns whether p is the point at infinity
+func (p Point) IsInfinity() bool {
+	return p.X == nil
+}
+
+// jacobianPoint is a point in Jacobian coordinates (X/Z², Y/Z³), which
+// avoids a modular inverse for every addition. Z is 0 at infinity.
+type jacobianPoint struct {
+	X, Y, Z *big.Int
+}
+
+func toJacobian(p Point) jacobianPoint {
+	if p.IsInfinity() {
+		return jacobianPoint{new(big.Int), new(big.Int), new(big.Int)}
+	}
+	return jacobianPoint{new(big.Int).Set(p.X), new(big.Int).Set(p.Y), big.NewInt(1)}
+}
+
+func (j jacobianPoint) toAffine() Point {
+	if j.Z.Sign() == 0 {
+		return Point{}
+	}
+	P := secp256k1.P
+	zInv := new(big.Int).ModInverse(j.Z, P)
+	zInv2 := new(big.Int).Mul(zInv, zInv)
+	x := new(big.Int).Mul(j.X, zInv2)
+	x.Mod(x, P)
+	y := new(big.Int).Mul(j.Y, zInv2.Mul(zInv2, zInv))
+	y.Mod(y, P)
+	return Point{x, y}
+}
+
+// double returns 2j (dbl-2009-l, a = 0)
+func (j jacobianPoint) double() jacobianPoint {
+	if j.Z.Sign() == 0 || j.Y.Sign() == 0 {
+		return jacobianPoint{new(big.Int), new(big.Int), new(big.Int)}
+	}
+	P := secp256k1.P
+	a := new(big.Int).Mul(j.X, j.X)
+	b := new(big.Int).Mul(j.Y, j.Y)
+	c := new(big.Int).Mul(b, b)
+	c.Mod(c, P)
+	// d = 2((X+B)² - A - C)
+	d := new(big.Int).Add(j.X, b)
+	d.Mul(d, d).Sub(d, a).Sub(d, c).Lsh(d, 1)
+	e := new(big.Int).Mul(a, big.NewInt(3))
+	f := new(big.Int).Mul(e, e)
+	x := new(big.Int).Sub(f, new(big.Int).Lsh(d, 1))
+	x.Mod(x, P)
+	y := new(big.Int).Sub(d, x)
+	y.Mul(y, e).Sub(y, c.Lsh(c, 3))
+	y.Mod(y, P)
+	z := new(big.Int).Mul(j.Y, j.Z)
+	z.Lsh(z, 1).Mod(z, P)
+	return jacobianPoint{x, y, z}
+}
+
+// add returns j + k (add-2007-bl)
+func (j jacobianPoint) add(k jacobianPoint) jacobianPoint {
+	if j.Z.Sign() == 0 {
+		return k
+	}
+	if k.Z.Sign() == 0 {
+		return j
+	}
+	P := secp256k1.P
+	z1z1 := new(big.Int).Mul(j.Z, j.Z)
+	z1z1.Mod(z1z1, P)
+	z2z2 := new(big.Int).Mul(k.Z, k.Z)
+	z2z2.Mod(z2z2, P)
+	u1 := new(big.Int).Mul(j.X, z2z2)
+	u1.Mod(u1, P)
+	u2 := new(big.Int).Mul(k.X, z1z1)
+	u2.Mod(u2, P)
+	s1 := new(big.Int).Mul(j.Y, k.Z)
+	s1.Mul(s1, z2z2).Mod(s1, P)
+	s2 := new(big.Int).Mul(k.Y, j.Z)
+	s2.Mul(s2, z1z1).Mod(s2, P)
+
+	h := new(big.Int).Sub(u2, u1)
+	h.Mod(h, P)
+	r := new(big.Int).Sub(s2, s1)
+	r.Mod(r, P)
+	if h.Sign() == 0 {
+		if r.Sign() == 0 {
+			return j.double()
+		}
+		return jacobianPoint{new(big.Int), new(big.Int), new(big.Int)}
+	}
+	r.Lsh(r, 1)
+	i := new(big.Int).Lsh(h, 1)
+	i.Mul(i, i)
+	jj := new(big.Int).Mul(h, i)
+	v := new(big.Int).Mul(u1, i)
+
+	x := new(big.Int).Mul(r, r)
+	x.Sub(x, jj).Sub(x, new(big.Int).Lsh(v, 1)).Mod(x, P)
+	y := new(big.Int).Sub(v, x)
+	y.Mul(y, r).Sub(y, new(big.Int).Lsh(new(big.Int).Mul(s1, jj), 1)).Mod(y, P)
+	z := new(big.Int).Add(j.Z, k.Z)
+	z.Mul(z, z).Sub(z, z1z1).Sub(z, z2z2).Mul(z, h).Mod(z, P)
+	return jacobianPoint{x, y, z}
+}
+
+// Add returns p + q
+func (p Point) Add(q Point) Point {
+	return toJacobian(p).add(toJacobian(q)).toAffine()
+}
+
+// ScalarMult returns kp
+func (p Point) ScalarMult(k *big.Int) Point {
+	result := toJacobian(Point{})
+	addend := toJacobian(p)
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		result = result.double()
+		if k.Bit(i) == 1 {
+			result = result.add(addend)
+		}
+	}
+	return result.toAffine()
+}
+
+// ScalarBaseMult returns kG
+func ScalarBaseMult(k *big.Int) Point {
+	return Point{secp256k1.Gx, secp256k1.Gy}.ScalarMult(k)
+}
+
+// SerializeCompressed encodes a point as 33 bytes: a 2 or 3
+// for the parity of Y followed by X
+func (p Point) SerializeCompressed() []byte {
+	b := make([]byte, 33)
+	b[0] = 2 + byte(p.Y.Bit(0))
+	p.X.FillBytes(b[1:])
+	return b
+}
+
+// ParseCompressedPoint decodes a 33 byte compressed point
+func ParseCompressedPoint(b []byte) (Point, error) {
+	if len(b) != 33 || (b[0] != 2 && b[0] != 3) {
+		return Point{}, errors.New("invalid compressed public key")
+	}
+	P := secp256k1.P
+	x := new(big.Int).SetBytes(b[1:])
+	if x.Cmp(P) >= 0 {
+		return Point{}, errors.New("public key is not on the curve")
+	}
+	y, err := liftX(x)
+	if err != nil {
+		return Point{}, err
+	}
+	if y.Bit(0) != uint(b[0]&1) {
+		y.Sub(P, y)
+	}
+	return Point{x, y}, nil
+}
+
+// liftX returns the even Y coordinate of the point with the provided X
+func liftX(x *big.Int) (*big.Int, error) {
+	P := secp256k1.P
+	// y² = x³ + 7
+	c := new(big.Int).Exp(x, big.NewInt(3), P)
+	c.Add(c, secp256k1.B).Mod(c, P)
+	// P ≡ 3 (mod 4), so the square root is c^((P+1)/4)
+	e := new(big.Int).Add(P, big.NewInt(1))
+	e.Rsh(e, 2)
+	y := new(big.Int).Exp(c, e, P)
+	if new(big.Int).Exp(y, big.NewInt(2), P).Cmp(c) != 0 {
+		return nil, errors.New("public key is not on the curve")
+	}
+	if y.Bit(0) == 1 {
+		y.Sub(P, y)
+	}
+	return y, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestScalarBaseMult(t *testing.T) {
+	tests := []struct {
+		k          int64
+		compressed string
+	}{
+		{1, "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+		{2, "02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5"},
+		{3, "02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9"},
+	}
+	for _, test := range tests {
+		p := ScalarBaseMult(big.NewInt(test.k))
+		if got := hex.EncodeToString(p.SerializeCompressed()); got != test.compressed {
+			t.Errorf("%dG = %s, want %s", test.k, got, test.compressed)
+		}
+	}
+
+	g := ScalarBaseMult(big.NewInt(1))
+	if sum, want := g.Add(g).Add(g), ScalarBaseMult(big.NewInt(3)); sum.X.Cmp(want.X) != 0 || sum.Y.Cmp(want.Y) != 0 {
+		t.Error("G+G+G isn't 3G")
+	}
+	if !ScalarBaseMult(secp256k1.N).IsInfinity() {
+		t.Error("NG isn't the point at infinity")
+	}
+}
+
+func TestParseCompressedPoint(t *testing.T) {
+	tests := []struct {
+		name       string
+		compressed string
+		wantErr    bool
+	}{
+		{name: "G", compressed: "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+		{name: "odd Y", compressed: "0379be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"},
+		{name: "uncompressed prefix", compressed: "0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", wantErr: true},
+		{name: "not on the curve", compressed: "020000000000000000000000000000000000000000000000000000000000000000", wantErr: true},
+		{name: "X above the field", compressed: "02ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff", wantErr: true},
+		{name: "too short", compressed: "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f817", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, _ := hex.DecodeString(test.compressed)
+			p, err := ParseCompressedPoint(b)
+			if test.wantErr {
+				if err == nil {
+					t.Error("parsed an invalid point")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(p.SerializeCompressed()); got != test.compressed {
+				t.Errorf("got %s back", got)
+			}
+		})
+	}
+}
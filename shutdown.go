@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultShutdownTimeout int = 6
+	// StoppedChecksTimeout is how long the checks still running after
+	// SHUTDOWN_TIMEOUT get to return once they're stopped
+	StoppedChecksTimeout time.Duration = 1 * time.Second
+	// FlushTimeout is how long pending notifications get to be
+	// delivered on shutdown
+	FlushTimeout time.Duration = 2 * time.Second
+)
+
+// Shutdown stops the API, gives the running checks up to SHUTDOWN_TIMEOUT
+// seconds to finish, delivers the pending notifications and closes the
+// database. The scheduler and outbox must already be stopped, which
+// outboxDone is closed after.
+func (w Watcher) Shutdown(server *http.Server, outboxDone chan bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(w.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Errorf("unable to stop the API: %v", err)
+	}
+	if err := w.Scheduler.Wait(ctx); err != nil {
+		log.Warnf("checks still running after %d seconds, stopping them", w.ShutdownTimeout)
+		w.Watches.CancelAll()
+		// Stopped checks return between requests, so the
+		// database can't be closed from under them
+		stopped, cancelStopped := context.WithTimeout(context.Background(), StoppedChecksTimeout)
+		defer cancelStopped()
+		if err := w.Scheduler.Wait(stopped); err != nil {
+			log.Warnf("checks still running after being stopped, closing the database anyway")
+		}
+	}
+
+	<-outboxDone
+	// ctx may have expired waiting for the checks
+	flush, cancelFlush := context.WithTimeout(context.Background(), FlushTimeout)
+	defer cancelFlush()
+	w.DeliverPendingNotifications(flush)
+
+	db, err := w.DB.DB()
+	if err != nil {
+		log.Errorf("unable to close the database: %v", err)
+		return
+	}
+	if err := db.Close(); err != nil {
+		log.Errorf("unable to close the database: %v", err)
+	}
+}
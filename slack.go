@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	NotifierSlack string = "slack"
+
+	// SlackMaxTransactions is the most transactions listed in one message
+	SlackMaxTransactions int = 10
+	// SlackChannelMention notifies everyone in the channel
+	SlackChannelMention string = "<!channel>"
+)
+
+// SlackPayload is the body sent to a Slack incoming webhook
+type SlackPayload struct {
+	Text   string       `json:"text"`
+	Blocks []SlackBlock `json:"blocks"`
+}
+
+// SlackBlock is a Block Kit layout block
+type SlackBlock struct {
+	Type   string      `json:"type"`
+	Text   *SlackText  `json:"text,omitempty"`
+	Fields []SlackText `json:"fields,omitempty"`
+}
+
+// SlackText is a Block Kit text object
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// SlackNotifier sends notifications to a Slack incoming webhook.
+// SlackNotifier implements the Notifier interface
+type SlackNotifier struct {
+	Webhook string
+}
+
+// NewSlackNotifier creates a SlackNotifier from the configuration
+func NewSlackNotifier(c Config) (Notifier, error) {
+	if c.SlackWebhook == "" {
+		return nil, errors.New("SLACK_WEBHOOK is not set")
+	}
+	return SlackNotifier{Webhook: c.SlackWebhook}, nil
+}
+
+// Name returns the name of the notifier
+func (s SlackNotifier) Name() string {
+	return NotifierSlack
+}
+
+// Notify sends a BalanceEvent to Slack formatted with Block Kit
+func (s SlackNotifier) Notify(ctx context.Context, e BalanceEvent) error {
+	payload, err := s.Payload(e)
+	if err != nil {
+		return err
+	}
+	// Mention the channel so high priority alerts aren't missed
+	if e.Priority == PriorityHigh {
+		payload.Text = SlackChannelMention + " " + payload.Text
+		payload.Blocks = append([]SlackBlock{{
+			Type: "section",
+			Text: &SlackText{Type: "mrkdwn", Text: SlackChannelMention},
+		}}, payload.Blocks...)
+	}
+	resp, err := postJSON(ctx, s.Webhook, payload)
+	if err != nil {
+		return fmt.Errorf("error calling Slack API: %w", err)
+	}
+	defer resp.Body.Close()
+	// Slack answers a successful webhook call with 200 and "ok"
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error calling Slack API: %s", resp.Status)
+	}
+	return nil
+}
+
+// Payload builds the Block Kit message for a BalanceEvent
+func (s SlackNotifier) Payload(e BalanceEvent) (SlackPayload, error) {
+	// A custom template replaces the fields with the rendered message
+	if e.MessageTemplate != "" {
+		message, err := e.Message()
+		if err != nil {
+			return SlackPayload{}, err
+		}
+		return SlackPayload{
+			Text: message,
+			Blocks: []SlackBlock{
+				{
+					Type: "header",
+					Text: &SlackText{Type: "plain_text", Text: e.Title()},
+				},
+				{
+					Type: "section",
+					Text: &SlackText{Type: "mrkdwn", Text: message},
+				},
+			},
+		}, nil
+	}
+
+	field := func(name string, value interface{}) SlackText {
+		return SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*%s*\n%v", name, value)}
+	}
+
+	payload := SlackPayload{
+		// Text is shown in notifications and clients that can't show blocks
+		Text: fmt.Sprintf("%s: \"%s\" changed from %d to %d sats",
+			e.Title(), e.Nickname, e.PreviousBalanceSat, e.BalanceSat),
+		Blocks: []SlackBlock{
+			{
+				Type: "header",
+				Text: &SlackText{Type: "plain_text", Text: e.Title()},
+			},
+			{
+				Type: "section",
+				Fields: []SlackText{
+					field("Nickname", e.Nickname),
+					field(e.KindName(), "`"+e.Identifier+"`"),
+					field("Previous Balance (satoshis)", e.PreviousBalanceSat),
+					field("New Balance (satoshis)", e.BalanceSat),
+					field("Previous Balance ("+e.Currency+")", e.PreviousBalanceCurrency),
+					field("New Balance ("+e.Currency+")", e.BalanceCurrency),
+					field("Transactions", e.TXCount),
+				},
+			},
+		},
+	}
+	if e.PendingBalanceSat != 0 {
+		payload.Blocks[1].Fields = append(payload.Blocks[1].Fields,
+			field("Confirmed Balance (satoshis)", e.ConfirmedBalanceSat),
+			field("Pending Balance (satoshis)", e.PendingBalanceSat))
+	}
+	if e.SpendableBalanceSat != e.BalanceSat {
+		payload.Blocks[1].Fields = append(payload.Blocks[1].Fields,
+			field("Spendable Balance (satoshis)", e.SpendableBalanceSat))
+	}
+	for i, t := range e.Transactions {
+		// Messages can only have 50 blocks
+		if i == SlackMaxTransactions {
+			break
+		}
+		payload.Blocks = append(payload.Blocks, SlackBlock{
+			Type: "section",
+			Text: &SlackText{Type: "mrkdwn", Text: fmt.Sprintf("*Transaction* `%s`\n%s %d sats, fee %d sats, %s",
+				t.TXID, t.Direction, t.NetSat, t.FeeSat, t.Status())},
+		})
+	}
+	return payload, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	NotifierTelegram string = "telegram"
+
+	DefaultTelegramAPI string = "https://api.telegram.org"
+)
+
+// telegramEscaper escapes every character that is reserved in MarkdownV2
+var telegramEscaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`,
+	")", `\)`, "~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`,
+	"-", `\-`, "=", `\=`, "|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`,
+	"!", `\!`,
+)
+
+// TelegramPayload is the body sent to the sendMessage method
+type TelegramPayload struct {
+	ChatID    string `json:"chat_id"`
+	Text      string `json:"text"`
+	ParseMode string `json:"parse_mode"`
+}
+
+// TelegramResponse is the response from the Telegram Bot API
+type TelegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+// TelegramNotifier sends notifications with a Telegram bot.
+// TelegramNotifier implements the Notifier interface
+type TelegramNotifier struct {
+	APIURL   string
+	BotToken string
+	ChatID   string
+}
+
+// NewTelegramNotifier creates a TelegramNotifier from the configuration
+func NewTelegramNotifier(c Config) (Notifier, error) {
+	if c.TelegramBotToken == "" {
+		return nil, errors.New("TELEGRAM_BOT_TOKEN is not set")
+	}
+	if c.TelegramChatID == "" {
+		return nil, errors.New("TELEGRAM_CHAT_ID is not set")
+	}
+	apiURL := c.TelegramAPIURL
+	if apiURL == "" {
+		apiURL = DefaultTelegramAPI
+	}
+	return TelegramNotifier{
+		APIURL:   strings.TrimSuffix(apiURL, "/"),
+		BotToken: c.TelegramBotToken,
+		ChatID:   c.TelegramChatID,
+	}, nil
+}
+
+// Name returns the name of the notifier
+func (t TelegramNotifier) Name() string {
+	return NotifierTelegram
+}
+
+// Notify sends the rendered message for a BalanceEvent to the chat
+func (t TelegramNotifier) Notify(ctx context.Context, e BalanceEvent) error {
+	message, err := e.EscapedMessage(&markdownV2Escaper)
+	if err != nil {
+		return err
+	}
+
+	resp, err := postJSON(ctx, t.APIURL+"/bot"+t.BotToken+"/sendMessage", TelegramPayload{
+		ChatID:    t.ChatID,
+		Text:      message,
+		ParseMode: "MarkdownV2",
+	})
+	if err != nil {
+		// The URL contains the bot token, so leave it out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("error calling Telegram API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tr TelegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return fmt.Errorf("error calling Telegram API (%s): unable to parse response: %w", resp.Status, err)
+	}
+	if !tr.OK {
+		return fmt.Errorf("error calling Telegram API (%s): %s", resp.Status, tr.Description)
+	}
+	return nil
+}
+
+// markdownV2Escaper escapes messages for Telegram's MarkdownV2 parse mode
+var markdownV2Escaper = Escaper{
+	Text:  EscapeMarkdownV2Template,
+	Value: EscapeMarkdownV2,
+}
+
+// EscapeMarkdownV2 escapes text for Telegram's MarkdownV2 parse mode
+func EscapeMarkdownV2(text string) string {
+	return telegramEscaper.Replace(text)
+}
+
+// EscapeMarkdownV2Template escapes the text of a message template for
+// Telegram's MarkdownV2 parse mode. Bold text written as **text** (as in
+// the message templates) is kept bold.
+func EscapeMarkdownV2Template(text string) string {
+	return strings.ReplaceAll(EscapeMarkdownV2(text), `\*\*`, "*")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEscapedMessageMarkdownV2(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		nickname string
+		want     string
+	}{
+		{
+			name:     "template bold is kept",
+			template: "**{{ .Nickname }}** changed",
+			nickname: "Savings",
+			want:     "*Savings* changed",
+		},
+		{
+			name:     "bold markers in values are escaped",
+			template: "**{{ .Nickname }}**",
+			nickname: "**not bold**",
+			want:     `*\*\*not bold\*\**`,
+		},
+		{
+			name:     "reserved characters in values are escaped",
+			template: "Nickname: {{ .Nickname }}.",
+			nickname: "a_b (c)",
+			want:     `Nickname: a\_b \(c\)\.`,
+		},
+		{
+			name:     "values inside if and with are escaped",
+			template: "{{ if .Nickname }}{{ .Nickname }}{{ end }}{{ with .Identifier }} {{ . }}-{{ end }}",
+			nickname: "x*y",
+			want:     `x\*y t\_1\-`,
+		},
+		{
+			name:     "variable declarations output nothing",
+			template: "{{ $n := .Nickname }}[{{ $n }}]",
+			nickname: "a.b",
+			want:     `\[a\.b\]`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := BalanceEvent{
+				Nickname:   test.nickname,
+				Identifier: "t_1",
+			}
+			got, err := RenderEscapedMessageTemplate("test", test.template, e, &markdownV2Escaper)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEscapedMessageDefaultTemplate(t *testing.T) {
+	e := BalanceEvent{Kind: KindAddress, Nickname: "**Cold** storage", Identifier: "bc1q"}
+	got, err := e.EscapedMessage(&markdownV2Escaper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, "*Address Balance Changed*\n") {
+		t.Errorf("title isn't bold: %q", got)
+	}
+	if !strings.Contains(got, `Nickname: \*\*Cold\*\* storage`) {
+		t.Errorf("nickname isn't escaped: %q", got)
+	}
+
+	plain, err := e.Message()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(plain, "Nickname: **Cold** storage") {
+		t.Errorf("unescaped message changed: %q", plain)
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// MessageTemplate is a user-defined notification template. Notifiers
+// is a comma-separated list of notifiers that use it by default.
+type MessageTemplate struct {
+	Name      string `gorm:"primaryKey"`
+	Body      string
+	Notifiers string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// TemplatePOST is used to save a MessageTemplate
+type TemplatePOST struct {
+	Name      string `json:"name"`
+	Body      string `json:"body"`
+	Notifiers string `json:"notifiers"`
+}
+
+// TemplateResponse is the response from a
+// SaveTemplate or DeleteTemplate request
+type TemplateResponse struct {
+	Errors string `json:"errors,omitempty"`
+}
+
+// PreviewTemplatePOST is used to render a template against a watch.
+// If Body is empty, the saved template called Name is used, and
+// if both are empty the watch's own template is used.
+type PreviewTemplatePOST struct {
+	Identifier string `json:"identifier"`
+	Name       string `json:"name"`
+	Body       string `json:"body"`
+}
+
+// PreviewTemplateResponse is the response from a
+// PreviewTemplate request
+type PreviewTemplateResponse struct {
+	Errors  string `json:"errors,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Escaper escapes a message for the markup of a notifier. Text is
+// applied to the text of the template, and Value to every value the
+// template outputs, so the markup of the template can be kept while
+// the values are always displayed as they are.
+type Escaper struct {
+	Text  func(string) string
+	Value func(string) string
+}
+
+// escapeValueFunc is the template function added to the
+// end of every output pipeline by Escaper
+const escapeValueFunc = "escapeValue"
+
+// RenderMessageTemplate renders a message template with a BalanceEvent
+func RenderMessageTemplate(name string, body string, e BalanceEvent) (string, error) {
+	return RenderEscapedMessageTemplate(name, body, e, nil)
+}
+
+// RenderEscapedMessageTemplate renders a message template with a
+// BalanceEvent, escaping it with escaper if it isn't nil
+func RenderEscapedMessageTemplate(name string, body string, e BalanceEvent, escaper *Escaper) (string, error) {
+	escapeValue := func(v interface{}) string { return fmt.Sprint(v) }
+	if escaper != nil {
+		escapeValue = func(v interface{}) string { return escaper.Value(fmt.Sprint(v)) }
+	}
+	t, err := template.New(name).
+		Funcs(template.FuncMap{escapeValueFunc: escapeValue}).
+		Parse(body)
+	if err != nil {
+		return "", fmt.Errorf("error setting up template: %w", err)
+	}
+	if escaper != nil {
+		for _, tt := range t.Templates() {
+			if tt.Tree != nil {
+				escapeTemplateNodes(tt.Tree.Root, escaper.Text)
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, e); err != nil {
+		return "", fmt.Errorf("error executing template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// escapeTemplateNodes escapes the text of a parsed template and pipes
+// the value of every action that outputs one through escapeValueFunc
+func escapeTemplateNodes(list *parse.ListNode, text func(string) string) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			n.Text = []byte(text(string(n.Text)))
+		case *parse.ActionNode:
+			// Variable declarations don't output anything
+			if len(n.Pipe.Decl) == 0 {
+				n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+					NodeType: parse.NodeCommand,
+					Pos:      n.Pos,
+					Args:     []parse.Node{parse.NewIdentifier(escapeValueFunc).SetPos(n.Pos)},
+				})
+			}
+		case *parse.IfNode:
+			escapeTemplateNodes(n.List, text)
+			escapeTemplateNodes(n.ElseList, text)
+		case *parse.RangeNode:
+			escapeTemplateNodes(n.List, text)
+			escapeTemplateNodes(n.ElseList, text)
+		case *parse.WithNode:
+			escapeTemplateNodes(n.List, text)
+			escapeTemplateNodes(n.ElseList, text)
+		}
+	}
+}
+
+// ValidateMessageTemplate checks that a template parses and can be
+// rendered with an example BalanceEvent
+func ValidateMessageTemplate(body string) error {
+	if strings.TrimSpace(body) == "" {
+		return errors.New("template body is empty")
+	}
+	example := BalanceEvent{
+		Kind:                    KindAddress,
+		Network:                 chainParams.Name,
+		Identifier:              "bc1qexample",
+		Nickname:                "Example",
+		BalanceSat:              150000,
+		ConfirmedBalanceSat:     150000,
+		SpendableBalanceSat:     150000,
+		PreviousBalanceSat:      100000,
+		Currency:                CurrencyUSD,
+		BalanceCurrency:         "45.00",
+		PreviousBalanceCurrency: "30.00",
+		TXCount:                 2,
+		Transactions: []WatchedTransaction{
+			{
+				Identifier:    "bc1qexample",
+				TXID:          "0000000000000000000000000000000000000000000000000000000000000000",
+				Direction:     DirectionIncoming,
+				NetSat:        50000,
+				FeeSat:        200,
+				Confirmations: 1,
+				BlockHeight:   700000,
+			},
+		},
+		Time: time.Now(),
+	}
+	_, err := RenderMessageTemplate("validate", body, example)
+	return err
+}
+
+// GetMessageTemplate gets a MessageTemplate from the database by name
+func (w Watcher) GetMessageTemplate(name string) (t MessageTemplate) {
+	w.DB.Model(&MessageTemplate{}).
+		Where(&MessageTemplate{Name: name}).
+		Scan(&t)
+	return t
+}
+
+// ResolveMessageTemplate returns the template body to use for an event
+// sent with a notifier. The watch's template takes precedence over the
+// notifier's template. An empty string means the built-in template.
+func (w Watcher) ResolveMessageTemplate(e BalanceEvent, notifier string) string {
+	if e.Template != "" {
+		if t := w.GetMessageTemplate(e.Template); t.Name != "" {
+			return t.Body
+		}
+		log.Warnf("template \"%s\" for \"%s\" (%s) was not found, using the default",
+			e.Template, e.Nickname, e.Identifier)
+	}
+
+	var templates []MessageTemplate
+	w.DB.Model(&MessageTemplate{}).Order("name").Find(&templates)
+	for _, t := range templates {
+		for _, name := range SplitList(t.Notifiers) {
+			if name == notifier {
+				return t.Body
+			}
+		}
+	}
+	return ""
+}
+
+// GetTemplates returns every saved MessageTemplate
+func (w Watcher) GetTemplates(c *gin.Context) {
+	status := http.StatusOK
+	templates := []MessageTemplate{}
+	w.DB.Model(&MessageTemplate{}).Order("name").Find(&templates)
+	c.JSON(status, templates)
+}
+
+// SaveTemplate validates and creates or replaces a MessageTemplate
+func (w Watcher) SaveTemplate(c *gin.Context) {
+	status := http.StatusOK
+	body, _ := ioutil.ReadAll(c.Request.Body)
+	var req TemplatePOST
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusInternalServerError, TemplateResponse{
+			Errors: fmt.Sprint(err),
+		})
+		return
+	}
+
+	response := TemplateResponse{}
+	if req.Name == "" {
+		status = http.StatusBadRequest
+		response.Errors = "template name is empty"
+		c.JSON(status, response)
+		return
+	}
+	if err := ValidateMessageTemplate(req.Body); err != nil {
+		status = http.StatusBadRequest
+		response.Errors = fmt.Sprint(err)
+		c.JSON(status, response)
+		return
+	}
+	if err := w.ValidateNotifiers(req.Notifiers); err != nil {
+		status = http.StatusBadRequest
+		response.Errors = fmt.Sprint(err)
+		c.JSON(status, response)
+		return
+	}
+
+	t := MessageTemplate{
+		Name:      req.Name,
+		Body:      req.Body,
+		Notifiers: req.Notifiers,
+	}
+	if tx := w.DB.Save(&t); tx.Error != nil {
+		status = http.StatusInternalServerError
+		response.Errors = fmt.Sprint(tx.Error)
+	}
+	c.JSON(status, response)
+}
+
+// DeleteTemplate deletes a MessageTemplate. Watches still using it fall
+// back to the default template.
+func (w Watcher) DeleteTemplate(c *gin.Context) {
+	body, _ := ioutil.ReadAll(c.Request.Body)
+	var req TemplatePOST
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusInternalServerError, TemplateResponse{
+			Errors: fmt.Sprint(err),
+		})
+		return
+	}
+
+	status := http.StatusOK
+	tx := w.DB.Model(&MessageTemplate{}).
+		Where(&MessageTemplate{Name: req.Name}).
+		Delete(&MessageTemplate{Name: req.Name})
+	c.JSON(status, tx.RowsAffected == 1)
+}
+
+// PreviewTemplate renders a template against the current data of a watch
+func (w Watcher) PreviewTemplate(c *gin.Context) {
+	body, _ := ioutil.ReadAll(c.Request.Body)
+	var req PreviewTemplatePOST
+	if err := json.Unmarshal(body, &req); err != nil {
+		c.JSON(http.StatusInternalServerError, PreviewTemplateResponse{
+			Errors: fmt.Sprint(err),
+		})
+		return
+	}
+	req.Identifier = NormalizeIdentifier(req.Identifier)
+
+	status := http.StatusOK
+	var info Info
+	if IsPubkey(req.Identifier) {
+		if p := w.GetPubkeyInfo(c.Request.Context(), req.Identifier); (p != PubkeyInfo{}) {
+			info = p
+		}
+	} else {
+		if a := w.GetAddressInfo(c.Request.Context(), req.Identifier); (a != AddressInfo{}) {
+			info = a
+		}
+	}
+	if info == nil {
+		c.JSON(http.StatusNotFound, PreviewTemplateResponse{
+			Errors: "Identifier is not being watched",
+		})
+		return
+	}
+
+	e := info.BalanceEvent()
+	switch {
+	case req.Body != "":
+		e.MessageTemplate = req.Body
+	case req.Name != "":
+		t := w.GetMessageTemplate(req.Name)
+		if t.Name == "" {
+			c.JSON(http.StatusNotFound, PreviewTemplateResponse{
+				Errors: "Template was not found",
+			})
+			return
+		}
+		e.MessageTemplate = t.Body
+	default:
+		e.MessageTemplate = w.ResolveMessageTemplate(e, "")
+	}
+
+	message, err := e.Message()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, PreviewTemplateResponse{
+			Errors: fmt.Sprint(err),
+		})
+		return
+	}
+	c.JSON(status, PreviewTemplateResponse{Message: message})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateMessageTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"valid", "{{ .Nickname }}: {{ if .BalanceSat }}{{ .BalanceSat }}{{ end }}", ""},
+		{"empty", "  ", "empty"},
+		{"parse error", "{{ .Nickname ", "unclosed action"},
+		{"unknown field", "{{ .Balance }}", "can't evaluate field Balance"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateMessageTemplate(test.body)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("got %v, want no error", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got %v, want an error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveMessageTemplate(t *testing.T) {
+	w := Watcher{DB: newTestDB(t)}
+	w.DB.Create(&MessageTemplate{Name: "short", Body: "short body", Notifiers: "slack, telegram"})
+	w.DB.Create(&MessageTemplate{Name: "watch", Body: "watch body"})
+
+	tests := []struct {
+		name     string
+		template string
+		notifier string
+		want     string
+	}{
+		{"watch template overrides the notifier template", "watch", NotifierSlack, "watch body"},
+		{"notifier template", "", NotifierTelegram, "short body"},
+		{"default", "", NotifierDiscord, ""},
+		{"missing watch template falls back", "deleted", NotifierSlack, "short body"},
+		{"missing watch template falls back to the default", "deleted", NotifierDiscord, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := BalanceEvent{Identifier: "bc1q", Template: test.template}
+			if got := w.ResolveMessageTemplate(e, test.notifier); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPreviewTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := Watcher{DB: newTestDB(t)}
+	address := "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+	w.DB.Create(&AddressInfo{Address: address, Nickname: "Wallet", BalanceSat: 1000})
+	w.DB.Create(&MessageTemplate{Name: "short", Body: "{{ .Nickname }} has {{ .BalanceSat }} sats"})
+
+	tests := []struct {
+		name    string
+		request string
+		status  int
+		want    string
+	}{
+		{"body", `{"identifier":"` + address + `","body":"{{ .Nickname }}!"}`, http.StatusOK, "Wallet!"},
+		{"saved template", `{"identifier":"` + address + `","name":"short"}`, http.StatusOK, "Wallet has 1000 sats"},
+		{"default template", `{"identifier":"` + address + `"}`, http.StatusOK, "Nickname: Wallet"},
+		{"missing template", `{"identifier":"` + address + `","name":"deleted"}`, http.StatusNotFound, "not found"},
+		{"unknown field", `{"identifier":"` + address + `","body":"{{ .Balance }}"}`, http.StatusBadRequest, "Balance"},
+		{"not watched", `{"identifier":"bc1qnotwatched","body":"x"}`, http.StatusNotFound, "not being watched"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPost, "/template/preview", strings.NewReader(test.request))
+			w.PreviewTemplate(c)
+
+			var response PreviewTemplateResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if recorder.Code != test.status {
+				t.Errorf("got status %d, want %d (%+v)", recorder.Code, test.status, response)
+			}
+			if !strings.Contains(response.Message+response.Errors, test.want) {
+				t.Errorf("got %+v, want %q", response, test.want)
+			}
+		})
+	}
+}
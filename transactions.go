@@ -0,0 +1,567 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tyzbit/btcapi"
+)
+
+const (
+	DirectionIncoming string = "incoming"
+	DirectionOutgoing string = "outgoing"
+	DirectionSelf     string = "self"
+	DirectionUnknown  string = "unknown"
+
+	// ConfirmationsDropped is used as the confirmations of a transaction
+	// that was removed from the chain and isn't in the mempool either
+	ConfirmationsDropped   int = -1
+	DefaultReorgCheckDepth int = 6
+)
+
+// WatchedTransaction is a transaction seen on a watched
+// identifier (address or pubkey)
+type WatchedTransaction struct {
+	Identifier    string    `gorm:"primaryKey" json:"identifier"`
+	TXID          string    `gorm:"primaryKey;column:txid" json:"txid"`
+	Direction     string    `json:"direction"`
+	NetSat        int       `json:"netSat"`
+	FeeSat        int       `json:"feeSat"`
+	Confirmations int       `json:"confirmations"`
+	BlockHeight   int       `json:"blockHeight"`
+	BlockHash     string    `json:"blockHash"`
+	FirstSeen     time.Time `json:"firstSeen"`
+	// NotifiedConfirmations is the number of confirmations the transaction
+	// had when it was last reported, so milestones aren't reported twice
+	NotifiedConfirmations int `json:"-"`
+	// Suppressed is set when the notification for the transaction didn't
+	// match the watch's alert rules, so its follow-ups aren't sent either
+	Suppressed bool `json:"-"`
+	// Dust is set when every output the transaction sent to the watch is
+	// below DUST_THRESHOLD and the watch didn't fund it
+	Dust bool `json:"dust"`
+	// DustSat is the value of the outputs below DUST_THRESHOLD the
+	// transaction sent to the watch, even if it also sent larger ones
+	DustSat int `json:"dustSat"`
+
+	// dustOutputs and spentOutpoints are found by FillTransactionDetails
+	// and saved separately
+	dustOutputs    []DustOutput
+	spentOutpoints []Outpoint
+}
+
+// TransactionChanges holds the transaction changes found
+// while checking a watch
+type TransactionChanges struct {
+	// New holds the transactions seen for the first time
+	New []WatchedTransaction
+	// Confirmed holds the pending transactions that were mined
+	Confirmed []WatchedTransaction
+	// Milestones holds the transactions that reached a confirmation
+	// milestone, keyed by the deepest milestone reached
+	Milestones map[int][]WatchedTransaction
+	// Reorged holds the confirmed transactions whose block was removed
+	// from the chain, with the block they were previously confirmed in
+	Reorged []WatchedTransaction
+}
+
+// Confirmed returns whether the transaction has been mined
+func (t WatchedTransaction) Confirmed() bool {
+	return t.Confirmations > 0
+}
+
+// Status returns a description of the confirmation status
+// of the transaction
+func (t WatchedTransaction) Status() string {
+	if t.Confirmations == ConfirmationsDropped {
+		return "dropped"
+	}
+	if !t.Confirmed() {
+		return "unconfirmed"
+	}
+	return fmt.Sprintf("confirmed (%d confirmations)", t.Confirmations)
+}
+
+// SuppressTransactions marks transactions as not notified
+func (w Watcher) SuppressTransactions(transactions []WatchedTransaction) {
+	for _, t := range transactions {
+		tx := w.DB.Model(&WatchedTransaction{}).
+			Where(&WatchedTransaction{Identifier: t.Identifier, TXID: t.TXID}).
+			Update("suppressed", true)
+		if tx.Error != nil {
+			log.Errorf("unable to update transaction %s for %s: %v", t.TXID, t.Identifier, tx.Error)
+		}
+	}
+}
+
+// NotifiedTransactions returns the transactions that weren't suppressed
+func NotifiedTransactions(transactions []WatchedTransaction) []WatchedTransaction {
+	notified := []WatchedTransaction{}
+	for _, t := range transactions {
+		if !t.Suppressed {
+			notified = append(notified, t)
+		}
+	}
+	return notified
+}
+
+// GetKnownTXIDs returns the txids already stored for an identifier
+func (w Watcher) GetKnownTXIDs(identifier string) map[string]bool {
+	var txids []string
+	w.DB.Model(&WatchedTransaction{}).
+		Where(&WatchedTransaction{Identifier: identifier}).
+		Pluck("txid", &txids)
+	known := map[string]bool{}
+	for _, txid := range txids {
+		known[txid] = true
+	}
+	return known
+}
+
+// CheckTransactions detects the new transactions of a watch and follows
+// its existing ones until they are confirmed and have reached the
+// deepest confirmation milestone. If baseline is true, this is the first
+// scan of the watch and existing transactions aren't reported. If
+// mempoolOnly is true, only new transactions are detected, since the
+// existing ones can only change with a new block. Nothing is saved once
+// ctx is cancelled.
+func (w Watcher) CheckTransactions(ctx context.Context, identifier string, summaries []btcapi.AddressSummary, baseline bool, settings WatchSettings, mempoolOnly bool) TransactionChanges {
+	changes := TransactionChanges{New: w.DetectTransactions(ctx, identifier, summaries, baseline)}
+	if mempoolOnly || ctx.Err() != nil {
+		return changes
+	}
+	// Reorged transactions go back to pending, so this has
+	// to happen before the pending transactions are checked
+	changes.Reorged = w.VerifyTransactions(ctx, identifier)
+	changes.Confirmed = w.UpdatePendingTransactions(ctx, identifier, summaries)
+	changes.Milestones = w.UpdateMilestones(ctx, identifier, w.WatchMilestones(settings))
+	return changes
+}
+
+// DetectTransactions compares the txids in the address summaries of a
+// watch to the ones already stored and returns the new transactions with
+// their direction, net amount, fee and confirmation status. If baseline
+// is true, this is the first scan of the watch, so the transactions are
+// stored without looking up their details. Transactions whose details
+// can't be looked up aren't stored, so they're detected again next time.
+func (w Watcher) DetectTransactions(ctx context.Context, identifier string, summaries []btcapi.AddressSummary, baseline bool) []WatchedTransaction {
+	known := w.GetKnownTXIDs(identifier)
+	// scripts maps the scriptPubKey of every address belonging
+	// to the watch to the address
+	scripts := map[string]string{}
+	heights := map[string]int{}
+	txids := []string{}
+	for _, summary := range summaries {
+		scripts[summary.ValidateAddress.ScriptPubKey] = summary.ValidateAddress.Address
+		for _, txid := range summary.TXHistory.TXIDs {
+			if known[txid] {
+				continue
+			}
+			// Pubkey addresses can share transactions
+			known[txid] = true
+			txids = append(txids, txid)
+			heights[txid] = summary.TXHistory.BlockHeightsByTxid[txid]
+		}
+	}
+
+	// The tip height is only needed to count the confirmations
+	// of transactions from the first scan
+	tipHeight := 0
+	if baseline && len(txids) > 0 {
+		var err error
+		if tipHeight, err = w.TipHeight(ctx); err != nil {
+			log.Errorf("unable to get tip height: %v", err)
+		}
+	}
+
+	newTransactions := []WatchedTransaction{}
+	for _, txid := range txids {
+		t := WatchedTransaction{
+			Identifier:  identifier,
+			TXID:        txid,
+			Direction:   DirectionUnknown,
+			BlockHeight: heights[txid],
+			FirstSeen:   time.Now(),
+		}
+		if !baseline {
+			if err := w.FillTransactionDetails(ctx, &t, scripts); err != nil {
+				log.Errorf("unable to get details of transaction %s for %s, trying again next check: %v", txid, identifier, err)
+				continue
+			}
+		} else if t.BlockHeight > 0 && tipHeight >= t.BlockHeight {
+			t.Confirmations = tipHeight - t.BlockHeight + 1
+		}
+		// Milestones already passed are covered by this notification
+		t.NotifiedConfirmations = t.Confirmations
+
+		// The watch may have been removed
+		if ctx.Err() != nil {
+			break
+		}
+		if tx := w.DB.Create(&t); tx.Error != nil {
+			log.Errorf("unable to save transaction %s for %s: %v", txid, identifier, tx.Error)
+			continue
+		}
+		w.SaveDustOutputs(t.dustOutputs)
+		w.MarkDustSpent(identifier, t.spentOutpoints)
+		if t.Dust {
+			log.Warnf("transaction %s for %s only sent dust: %d sats", txid, identifier, t.NetSat)
+		} else if t.DustSat > 0 {
+			log.Warnf("transaction %s for %s sent %d sats of dust along with other outputs", txid, identifier, t.DustSat)
+		}
+		if !baseline {
+			log.Infof("new %s transaction %s for %s: %d sats", t.Direction, txid, identifier, t.NetSat)
+			newTransactions = append(newTransactions, t)
+		}
+	}
+	return newTransactions
+}
+
+// FillTransactionDetails looks up a transaction and calculates how much
+// it moved in or out of the provided scripts, along with its fee,
+// confirmation status and which of its outputs are dust
+func (w Watcher) FillTransactionDetails(ctx context.Context, t *WatchedTransaction, scripts map[string]string) error {
+	summary, err := w.Explorer.Tx(ctx, t.TXID)
+	if err != nil {
+		return fmt.Errorf("error calling explorer: %w", err)
+	}
+	t.Confirmations = summary.Confirmations
+	t.BlockHash = summary.BlockHash
+
+	received, outputs := 0, 0
+	receivedOutputs := []DustOutput{}
+	for _, vout := range summary.VOut {
+		value := vout.ValueSat()
+		outputs = outputs + value
+		if address, ok := scripts[vout.ScriptPubKey.Hex]; ok {
+			received = received + value
+			receivedOutputs = append(receivedOutputs, DustOutput{
+				Identifier: t.Identifier,
+				TXID:       t.TXID,
+				VOut:       vout.N,
+				Address:    address,
+				ValueSat:   value,
+				FirstSeen:  t.FirstSeen,
+			})
+		}
+	}
+
+	// The inputs only reference previous outputs, so those
+	// transactions are needed to find the amounts spent
+	spent, inputs, coinbase := 0, 0, false
+	for _, vin := range summary.VIn {
+		if vin.TXID == "" {
+			coinbase = true
+			continue
+		}
+		previous, err := w.Explorer.Tx(ctx, vin.TXID)
+		if err != nil {
+			return fmt.Errorf("error looking up input %s:%d: %w", vin.TXID, vin.VOut, err)
+		}
+		for _, vout := range previous.VOut {
+			if vout.N != vin.VOut {
+				continue
+			}
+			inputs = inputs + vout.ValueSat()
+			if _, ok := scripts[vout.ScriptPubKey.Hex]; ok {
+				spent = spent + vout.ValueSat()
+				t.spentOutpoints = append(t.spentOutpoints, Outpoint{TXID: vin.TXID, VOut: vin.VOut})
+			}
+		}
+	}
+
+	if !coinbase {
+		t.FeeSat = inputs - outputs
+	}
+	t.NetSat = received - spent
+
+	// Change from the watch's own transactions is never dust
+	if spent == 0 {
+		for _, o := range receivedOutputs {
+			if w.IsDust(o.ValueSat) {
+				t.dustOutputs = append(t.dustOutputs, o)
+				t.DustSat = t.DustSat + o.ValueSat
+			}
+		}
+		t.Dust = len(receivedOutputs) > 0 && len(t.dustOutputs) == len(receivedOutputs)
+	}
+	switch {
+	case t.NetSat > 0:
+		t.Direction = DirectionIncoming
+	case t.NetSat < 0:
+		t.Direction = DirectionOutgoing
+	default:
+		t.Direction = DirectionSelf
+	}
+	return nil
+}
+
+// GetPendingTransactions returns the unconfirmed transactions of a watch.
+// Transactions without details (from the first scan of a watch) are
+// left out since they were never reported.
+func (w Watcher) GetPendingTransactions(identifier string) (pending []WatchedTransaction) {
+	w.DB.Model(&WatchedTransaction{}).
+		Where("identifier = ? AND confirmations = 0 AND direction <> ?", identifier, DirectionUnknown).
+		Find(&pending)
+	return pending
+}
+
+// UpdatePendingTransactions checks whether the unconfirmed transactions of
+// a watch have been mined and returns the ones that have been
+func (w Watcher) UpdatePendingTransactions(ctx context.Context, identifier string, summaries []btcapi.AddressSummary) []WatchedTransaction {
+	heights := map[string]int{}
+	for _, summary := range summaries {
+		for txid, height := range summary.TXHistory.BlockHeightsByTxid {
+			heights[txid] = height
+		}
+	}
+
+	pending := w.GetPendingTransactions(identifier)
+	confirmed := []WatchedTransaction{}
+	for _, t := range pending {
+		if ctx.Err() != nil {
+			break
+		}
+		// Skip the lookup if the address summary says it's still unconfirmed
+		if height, ok := heights[t.TXID]; ok && height <= 0 {
+			continue
+		}
+		summary, err := w.Explorer.Tx(ctx, t.TXID)
+		if err != nil {
+			log.Errorf("unable to check confirmations of transaction %s for %s: %v", t.TXID, identifier, err)
+			continue
+		}
+		if summary.Confirmations <= 0 {
+			continue
+		}
+
+		t.Confirmations = summary.Confirmations
+		t.NotifiedConfirmations = summary.Confirmations
+		t.BlockHash = summary.BlockHash
+		if height := heights[t.TXID]; height > 0 {
+			t.BlockHeight = height
+		}
+		if tx := w.DB.Save(&t); tx.Error != nil {
+			log.Errorf("unable to update transaction %s for %s: %v", t.TXID, identifier, tx.Error)
+			continue
+		}
+		log.Infof("%s transaction %s for %s confirmed", t.Direction, t.TXID, identifier)
+		confirmed = append(confirmed, t)
+	}
+	return confirmed
+}
+
+// UpdateMilestones counts the confirmations of the reported transactions
+// of a watch that haven't reached the deepest of the provided milestones
+// yet and returns the ones that passed a milestone since they were last
+// reported, keyed by the deepest milestone they reached
+func (w Watcher) UpdateMilestones(ctx context.Context, identifier string, milestones []int) map[int][]WatchedTransaction {
+	reached := map[int][]WatchedTransaction{}
+	if len(milestones) == 0 {
+		return reached
+	}
+
+	following := []WatchedTransaction{}
+	w.DB.Model(&WatchedTransaction{}).
+		Where("identifier = ? AND confirmations > 0 AND direction <> ? AND notified_confirmations < ?",
+			identifier, DirectionUnknown, milestones[len(milestones)-1]).
+		Find(&following)
+	if len(following) == 0 {
+		return reached
+	}
+
+	tipHeight, err := w.TipHeight(ctx)
+	if err != nil {
+		log.Errorf("unable to get tip height: %v", err)
+		return reached
+	}
+	for _, t := range following {
+		if ctx.Err() != nil {
+			break
+		}
+		if t.BlockHeight > 0 {
+			t.Confirmations = tipHeight - t.BlockHeight + 1
+		} else {
+			// The address summary didn't have the block height
+			summary, err := w.Explorer.Tx(ctx, t.TXID)
+			if err != nil {
+				log.Errorf("unable to check confirmations of transaction %s for %s: %v", t.TXID, identifier, err)
+				continue
+			}
+			t.Confirmations = summary.Confirmations
+			t.BlockHash = summary.BlockHash
+		}
+
+		milestone := 0
+		for _, m := range milestones {
+			if m > t.NotifiedConfirmations && m <= t.Confirmations {
+				milestone = m
+			}
+		}
+		if milestone > 0 {
+			t.NotifiedConfirmations = t.Confirmations
+		}
+		if tx := w.DB.Save(&t); tx.Error != nil {
+			log.Errorf("unable to update transaction %s for %s: %v", t.TXID, identifier, tx.Error)
+			continue
+		}
+		if milestone > 0 {
+			log.Infof("transaction %s for %s reached %d confirmations", t.TXID, identifier, milestone)
+			reached[milestone] = append(reached[milestone], t)
+		}
+	}
+	return reached
+}
+
+// VerifyTransactions checks that the blocks of the transactions of a watch
+// confirmed in the last REORG_CHECK_DEPTH blocks are still in the chain
+// and returns the transactions that were reorganized out of it. They
+// are returned to pending if they're back in the mempool, or deleted if
+// the explorer says it doesn't know them anymore, so they are detected
+// again if they reappear.
+func (w Watcher) VerifyTransactions(ctx context.Context, identifier string) []WatchedTransaction {
+	reorged := []WatchedTransaction{}
+	tipHeight, err := w.TipHeight(ctx)
+	if err != nil {
+		log.Errorf("unable to get tip height: %v", err)
+		return reorged
+	}
+
+	recent := []WatchedTransaction{}
+	w.DB.Model(&WatchedTransaction{}).
+		Where("identifier = ? AND block_height > 0 AND block_height > ?", identifier, tipHeight-w.ReorgCheckDepth).
+		Find(&recent)
+	// Transactions often share blocks, so only look up each height once
+	hashes := map[int]string{}
+	for _, t := range recent {
+		if ctx.Err() != nil {
+			break
+		}
+		hash, ok := hashes[t.BlockHeight]
+		if !ok {
+			block, err := w.Explorer.BlockWithHeight(ctx, t.BlockHeight)
+			if err != nil {
+				log.Errorf("unable to get block %d: %v", t.BlockHeight, err)
+				continue
+			}
+			hash = block.Hash
+			hashes[t.BlockHeight] = hash
+		}
+		if t.BlockHash == hash {
+			continue
+		}
+		// Transactions from address summaries only have a block height
+		if t.BlockHash == "" {
+			t.BlockHash = hash
+			if tx := w.DB.Save(&t); tx.Error != nil {
+				log.Errorf("unable to update transaction %s for %s: %v", t.TXID, identifier, tx.Error)
+			}
+			continue
+		}
+
+		previous := t
+		summary, err := w.Explorer.Tx(ctx, t.TXID)
+		// Only a clear "not found" means the transaction is gone, any
+		// other error (like being rate limited) is tried again next time
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			log.Errorf("unable to verify transaction %s for %s: %v", t.TXID, identifier, err)
+			continue
+		}
+		switch {
+		case err == nil && summary.Confirmations > 0:
+			// Mined again in the new chain, or the block height was
+			// wrong, so it's still confirmed
+			block, err := w.Explorer.BlockWithHash(ctx, summary.BlockHash)
+			if err != nil {
+				log.Errorf("unable to get block %s: %v", summary.BlockHash, err)
+				continue
+			}
+			if summary.BlockHash != t.BlockHash {
+				log.Warnf("transaction %s for %s moved from block %s to %s by a chain reorganization",
+					t.TXID, identifier, t.BlockHash, summary.BlockHash)
+			}
+			t.BlockHash = summary.BlockHash
+			t.BlockHeight = block.Height
+			t.Confirmations = summary.Confirmations
+			if tx := w.DB.Save(&t); tx.Error != nil {
+				log.Errorf("unable to update transaction %s for %s: %v", t.TXID, identifier, tx.Error)
+			}
+			continue
+		case err == nil:
+			log.Warnf("transaction %s for %s was reorganized out of block %s and is back in the mempool",
+				t.TXID, identifier, t.BlockHash)
+			t.Confirmations = 0
+			t.NotifiedConfirmations = 0
+			t.BlockHeight = 0
+			t.BlockHash = ""
+			if tx := w.DB.Save(&t); tx.Error != nil {
+				log.Errorf("unable to update transaction %s for %s: %v", t.TXID, identifier, tx.Error)
+				continue
+			}
+			previous.Confirmations = 0
+		default:
+			// The explorer couldn't find the transaction at all
+			log.Warnf("transaction %s for %s was reorganized out of block %s and is no longer known",
+				t.TXID, identifier, t.BlockHash)
+			if tx := w.DB.Delete(&t); tx.Error != nil {
+				log.Errorf("unable to delete transaction %s for %s: %v", t.TXID, identifier, tx.Error)
+				continue
+			}
+			w.DeleteTransactionDust(identifier, t.TXID)
+			previous.Confirmations = ConfirmationsDropped
+		}
+		reorged = append(reorged, previous)
+	}
+	return reorged
+}
+
+// WatchMilestones returns the confirmation milestones of a watch,
+// falling back to CONFIRMATION_MILESTONES if it doesn't set its own
+func (w Watcher) WatchMilestones(s WatchSettings) []int {
+	list := s.Milestones
+	if list == "" {
+		list = w.ConfirmationMilestones
+	}
+	// Both are validated before they are saved
+	milestones, _ := ParseMilestones(list)
+	return milestones
+}
+
+// ParseMilestones parses a comma-separated list of confirmation
+// counts into a sorted list without duplicates
+func ParseMilestones(list string) ([]int, error) {
+	seen := map[int]bool{}
+	milestones := []int{}
+	for _, entry := range SplitList(list) {
+		m, err := strconv.Atoi(entry)
+		if err != nil || m < 1 {
+			return nil, fmt.Errorf("milestone \"%s\" is not a positive number of confirmations", entry)
+		}
+		if !seen[m] {
+			seen[m] = true
+			milestones = append(milestones, m)
+		}
+	}
+	sort.Ints(milestones)
+	return milestones, nil
+}
+
+// PendingBalance returns the net amount of the unconfirmed
+// transactions of a watch
+func (w Watcher) PendingBalance(identifier string) int {
+	balance := 0
+	for _, t := range w.GetPendingTransactions(identifier) {
+		balance = balance + t.NetSat
+	}
+	return balance
+}
+
+// DeleteTransactions deletes all stored transactions for an identifier
+func (w Watcher) DeleteTransactions(identifier string) {
+	w.DB.Where(&WatchedTransaction{Identifier: identifier}).Delete(&WatchedTransaction{})
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tyzbit/btcapi"
+)
+
+const (
+	testFundingTXID  = "a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1"
+	testReceiveTXID  = "b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2"
+	testSpendTXID    = "c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3c3"
+	testWatchScript1 = "0014aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	testWatchScript2 = "0014bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+)
+
+// newTestExplorer serves the transactions in testdata/transactions.json,
+// which are in the format of the explorer's /api/tx route
+func newTestExplorer(t *testing.T) Explorer {
+	data, err := os.ReadFile("testdata/transactions.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &txs); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tx, ok := txs[strings.TrimPrefix(r.URL.Path, "/api/tx/")]
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":{"code":-5,"message":"No such mempool or blockchain transaction. Use gettransaction for wallet transactions."}}`))
+			return
+		}
+		w.Write(tx)
+	}))
+	t.Cleanup(server.Close)
+	return Explorer{URL: server.URL, Client: server.Client()}
+}
+
+func TestFillTransactionDetails(t *testing.T) {
+	w := Watcher{Explorer: newTestExplorer(t)}
+	scripts := map[string]string{
+		testWatchScript1: "bc1q42424242424242424242424242424242ty9ll3",
+		testWatchScript2: "bc1qhwamhwamhwamhwamhwamhwamhwamhwame6jz2r",
+	}
+
+	tests := []struct {
+		name          string
+		txid          string
+		dustThreshold int
+		direction     string
+		netSat        int
+		feeSat        int
+		confirmations int
+		spent         int
+		dust          bool
+		dustSat       int
+		dustOutputs   int
+	}{
+		{
+			name:          "incoming with a dust output",
+			txid:          testReceiveTXID,
+			dustThreshold: DefaultDustThreshold,
+			direction:     DirectionIncoming,
+			netSat:        12345 + 330,
+			feeSat:        50020000 - 12345 - 330 - 50000000,
+			confirmations: 3,
+			dustSat:       330,
+			dustOutputs:   1,
+		},
+		{
+			name:          "incoming dust",
+			txid:          testReceiveTXID,
+			dustThreshold: 20000,
+			direction:     DirectionIncoming,
+			netSat:        12345 + 330,
+			feeSat:        50020000 - 12345 - 330 - 50000000,
+			confirmations: 3,
+			dust:          true,
+			dustSat:       12345 + 330,
+			dustOutputs:   2,
+		},
+		{
+			name:          "dust disabled",
+			txid:          testReceiveTXID,
+			dustThreshold: -1,
+			direction:     DirectionIncoming,
+			netSat:        12345 + 330,
+			feeSat:        50020000 - 12345 - 330 - 50000000,
+			confirmations: 3,
+		},
+		{
+			name:          "outgoing",
+			txid:          testSpendTXID,
+			dustThreshold: 20000,
+			direction:     DirectionOutgoing,
+			netSat:        -12345,
+			feeSat:        12345 - 10000,
+			spent:         1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w.DustThreshold = test.dustThreshold
+			tx := WatchedTransaction{Identifier: "watch", TXID: test.txid}
+			if err := w.FillTransactionDetails(context.Background(), &tx, scripts); err != nil {
+				t.Fatal(err)
+			}
+			if tx.Direction != test.direction {
+				t.Errorf("direction %s, want %s", tx.Direction, test.direction)
+			}
+			if tx.NetSat != test.netSat {
+				t.Errorf("net %d sats, want %d", tx.NetSat, test.netSat)
+			}
+			if tx.FeeSat != test.feeSat {
+				t.Errorf("fee %d sats, want %d", tx.FeeSat, test.feeSat)
+			}
+			if tx.Confirmations != test.confirmations {
+				t.Errorf("%d confirmations, want %d", tx.Confirmations, test.confirmations)
+			}
+			if len(tx.spentOutpoints) != test.spent {
+				t.Errorf("%d outputs spent, want %d", len(tx.spentOutpoints), test.spent)
+			}
+			if tx.Dust != test.dust {
+				t.Errorf("dust %t, want %t", tx.Dust, test.dust)
+			}
+			if tx.DustSat != test.dustSat || len(tx.dustOutputs) != test.dustOutputs {
+				t.Errorf("%d sats of dust in %d outputs, want %d in %d",
+					tx.DustSat, len(tx.dustOutputs), test.dustSat, test.dustOutputs)
+			}
+		})
+	}
+}
+
+func TestFillTransactionDetailsUnknown(t *testing.T) {
+	w := Watcher{Explorer: newTestExplorer(t)}
+	tx := WatchedTransaction{TXID: strings.Repeat("d4", 32)}
+	err := w.FillTransactionDetails(context.Background(), &tx, map[string]string{})
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestDetectTransactionsWithoutDetails(t *testing.T) {
+	w := Watcher{DB: newTestDB(t), Explorer: newTestExplorer(t)}
+	unknown := strings.Repeat("d4", 32)
+	summary := btcapi.AddressSummary{}
+	summary.ValidateAddress.ScriptPubKey = testWatchScript1
+	summary.TXHistory.TXIDs = []string{testReceiveTXID, unknown}
+
+	detected := w.DetectTransactions(context.Background(), "bc1q", []btcapi.AddressSummary{summary}, false)
+	if len(detected) != 1 || detected[0].TXID != testReceiveTXID {
+		t.Fatalf("got %v, want only %s", detected, testReceiveTXID)
+	}
+	// The transaction without details is left for the next check
+	known := w.GetKnownTXIDs("bc1q")
+	if !known[testReceiveTXID] || known[unknown] {
+		t.Errorf("got known transactions %v, want only %s", known, testReceiveTXID)
+	}
+}
+
+func TestVerifyTransactions(t *testing.T) {
+	const (
+		txid         = "e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5e5"
+		oldBlockHash = "0000000000000000000000000000000000000000000000000000000000000a11"
+		newBlockHash = "0000000000000000000000000000000000000000000000000000000000000b22"
+	)
+	tests := []struct {
+		name string
+		// status and body are the response to looking up the transaction
+		status        int
+		body          string
+		reorged       int
+		kept          bool
+		confirmations int
+	}{
+		{
+			name:          "rate limited",
+			status:        http.StatusTooManyRequests,
+			body:          `{"error":"Too many requests"}`,
+			kept:          true,
+			confirmations: 2,
+		},
+		{
+			name:          "server error",
+			status:        http.StatusServiceUnavailable,
+			body:          `Service Unavailable`,
+			kept:          true,
+			confirmations: 2,
+		},
+		{
+			name:          "invalid response",
+			status:        http.StatusOK,
+			body:          `{"txid":`,
+			kept:          true,
+			confirmations: 2,
+		},
+		{
+			name:          "back in the mempool",
+			status:        http.StatusOK,
+			body:          `{"txid":"` + txid + `","vout":[]}`,
+			reorged:       1,
+			kept:          true,
+			confirmations: 0,
+		},
+		{
+			name:    "unknown",
+			status:  http.StatusInternalServerError,
+			body:    `{"error":{"code":-5,"message":"No such mempool or blockchain transaction."}}`,
+			reorged: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/api/block/100" {
+					w.Write([]byte(`{"hash":"` + newBlockHash + `","height":100}`))
+					return
+				}
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+
+			w := Watcher{
+				DB:       newTestDB(t),
+				Explorer: Explorer{URL: server.URL, Client: server.Client()},
+				Tip:      NewTipTracker(),
+			}
+			w.ReorgCheckDepth = DefaultReorgCheckDepth
+			w.Tip.SetTip(newBlockHash, 101)
+			w.DB.Create(&WatchedTransaction{
+				Identifier:    "watch",
+				TXID:          txid,
+				Direction:     DirectionIncoming,
+				Confirmations: 2,
+				BlockHeight:   100,
+				BlockHash:     oldBlockHash,
+			})
+
+			reorged := w.VerifyTransactions(context.Background(), "watch")
+			if len(reorged) != test.reorged {
+				t.Errorf("%d transactions reorged, want %d", len(reorged), test.reorged)
+			}
+			var stored []WatchedTransaction
+			w.DB.Find(&stored)
+			if len(stored) == 1 != test.kept {
+				t.Fatalf("%d transactions stored, want kept %t", len(stored), test.kept)
+			}
+			if test.kept && stored[0].Confirmations != test.confirmations {
+				t.Errorf("%d confirmations, want %d", stored[0].Confirmations, test.confirmations)
+			}
+		})
+	}
+}
+
+func TestCheckTransactionsCancelled(t *testing.T) {
+	w := Watcher{DB: newTestDB(t), Explorer: newTestExplorer(t)}
+	w.DustThreshold = DefaultDustThreshold
+	summary := btcapi.AddressSummary{}
+	summary.ValidateAddress.ScriptPubKey = testWatchScript1
+	summary.TXHistory.TXIDs = []string{testReceiveTXID}
+
+	// The watch was removed while it was being checked
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.CheckTransactions(ctx, "bc1q", []btcapi.AddressSummary{summary}, false, WatchSettings{}, false)
+	var count int64
+	w.DB.Model(&WatchedTransaction{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d transactions were saved after the check was cancelled", count)
+	}
+
+	err := w.CheckAddress(context.Background(), "bc1q42424242424242424242424242424242ty9ll3", false)
+	if err == nil {
+		t.Error("checking an address with no saved information didn't fail")
+	}
+	w.DB.Model(&AddressInfo{}).Count(&count)
+	if count != 0 {
+		t.Error("the information of a removed address was saved again")
+	}
+}
@@ -1,13 +1,11 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
-	"net/http"
-	"text/template"
+	"fmt"
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 const (
@@ -18,64 +16,94 @@ const (
 type Info interface {
 	GetIdentifier() string
 	GetNickname() string
+	BalanceEvent() BalanceEvent
 	Update(Watcher) error
 }
 
-// UpdateInfo calls Update() for the provided Info interface
-func (w Watcher) UpdateInfo(i Info) {
-	if err := i.Update(w); err != nil {
-		log.Errorf("error updating address info for \"%s\" (%s): %v",
-			i.GetNickname(), i.GetIdentifier(), err)
-	}
+// WatchSettings holds the per-watch settings shared by
+// AddressInfo and PubkeyInfo
+type WatchSettings struct {
+	// Notifiers is a comma-separated list of the notifiers to send this
+	// watch's notifications to. If empty, DEFAULT_NOTIFIERS is used.
+	Notifiers string
+	// Template is the name of the MessageTemplate to use for this
+	// watch's notifications. If empty, the notifier's template is used.
+	Template string
+	// Milestones is a comma-separated list of confirmation counts to
+	// notify at. If empty, CONFIRMATION_MILESTONES is used.
+	Milestones string
+	// Interval is how many seconds to wait between checks of
+	// this watch. If 0, SLEEP_INTERVAL is used.
+	Interval int
 }
 
-// AddCancelSignal adds a cancel channel to w.CancelSignals
-func (w Watcher) AddCancelSignal(i string, c chan bool) {
-	w.CancelSignals[i] = c
-	w.CancelWaitGroup.Done()
-}
+// watchSettingsColumns are the columns of WatchSettings, used to
+// update all settings at once even if they are being cleared
+var watchSettingsColumns = []string{"Notifiers", "Template", "Milestones", "Interval"}
+
+// checkOmittedColumns are the columns of AddressInfo and PubkeyInfo that
+// checks leave alone: the settings, which are only changed with
+// UpdateWatch, and Paused, which is only changed with SetPaused
+var checkOmittedColumns = append([]string{"Paused"}, watchSettingsColumns...)
 
-// DeleteCancelSignal deletes the cancel channel on w.CancelSignals
-func (w Watcher) DeleteCancelSignal(i string) {
-	// Only send to the channel if it's open and buffered
-	if w.CancelSignals[i] != make(chan bool, 1) {
-		w.CancelSignals[i] <- true
+// ValidateWatchSettings returns an error if a watch's settings refer
+// to notifiers or templates that don't exist or have invalid milestones
+func (w Watcher) ValidateWatchSettings(s WatchSettings) error {
+	if err := w.ValidateNotifiers(s.Notifiers); err != nil {
+		return err
+	}
+	if s.Template != "" && w.GetMessageTemplate(s.Template).Name == "" {
+		return fmt.Errorf("template \"%s\" was not found", s.Template)
+	}
+	if _, err := ParseMilestones(s.Milestones); err != nil {
+		return err
 	}
-	delete(w.CancelSignals, i)
-	w.CancelWaitGroup.Done()
+	if s.Interval < 0 {
+		return fmt.Errorf("interval %d can't be negative", s.Interval)
+	}
+	return nil
 }
 
-// SendNotification sends a message filled with values from a template
-// to Discord
-func (w Watcher) SendNotification(i interface{}, mt string) {
-	t, err := template.New("addressMessage").Parse(mt)
-	if err != nil {
-		log.Error("error setting up template: ", err)
-		return
+// IsWatched returns whether an identifier (address or pubkey)
+// is in the database
+func (w Watcher) IsWatched(id string) bool {
+	var count int64
+	if IsPubkey(id) {
+		w.DB.Model(&PubkeyInfo{}).Where(&PubkeyInfo{Pubkey: id}).Count(&count)
+	} else {
+		w.DB.Model(&AddressInfo{}).Where(&AddressInfo{Address: id}).Count(&count)
 	}
+	return count > 0
+}
 
-	var b bytes.Buffer
-	err = t.Execute(&b, i)
-	if err != nil {
-		log.Errorf("error executing template, err: %v", err)
-		return
+// GetWatchSettings returns the settings of an identifier (address or pubkey)
+func (w Watcher) GetWatchSettings(id string) WatchSettings {
+	if IsPubkey(id) {
+		p := PubkeyInfo{}
+		w.DB.Model(&PubkeyInfo{}).Where(&PubkeyInfo{Pubkey: id}).Scan(&p)
+		return p.WatchSettings
 	}
+	a := AddressInfo{}
+	w.DB.Model(&AddressInfo{}).Where(&AddressInfo{Address: id}).Scan(&a)
+	return a.WatchSettings
+}
 
-	message := b.String()
-	payload := DiscordPayload{
-		Content: message,
-	}
-	var m bytes.Buffer
-	err = json.NewEncoder(&m).Encode(payload)
-	if err != nil {
-		log.Errorf("unable to encode payload: %+v", payload)
-		return
+// SetPaused pauses or resumes an identifier (address or pubkey). It
+// returns false if the identifier isn't watched.
+func (w Watcher) SetPaused(id string, paused bool) bool {
+	var tx *gorm.DB
+	if IsPubkey(id) {
+		tx = w.DB.Model(&PubkeyInfo{}).Where(&PubkeyInfo{Pubkey: id}).Update("paused", paused)
+	} else {
+		tx = w.DB.Model(&AddressInfo{}).Where(&AddressInfo{Address: id}).Update("paused", paused)
 	}
+	return tx.RowsAffected == 1
+}
 
-	client := http.Client{}
-	resp, respErr := client.Post(w.DiscordWebhook, "application/json", &m)
-	if respErr != nil || resp.StatusCode != 204 {
-		log.Errorf("error calling Discord API (%s): %v", resp.Status, respErr)
-		return
+// UpdateInfo calls Update() for the provided Info interface
+func (w Watcher) UpdateInfo(i Info) {
+	if err := i.Update(w); err != nil {
+		log.Errorf("error updating address info for \"%s\" (%s): %v",
+			i.GetNickname(), i.GetIdentifier(), err)
 	}
 }
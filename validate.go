@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// addressHashLength is the length of the hash in
+	// legacy (P2PKH) and P2SH addresses
+	addressHashLength int = 20
+)
+
+// ValidateIdentifier checks that an identifier (address, pubkey or
+// descriptor) is valid for the network set with NETWORK, returning
+// it normalized: segwit addresses are lowercase and descriptors
+// end with their checksum
+func ValidateIdentifier(id string) (string, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return "", errors.New("identifier is empty")
+	}
+	if IsDescriptor(id) {
+		if _, err := ParseDescriptor(id); err != nil {
+			return "", fmt.Errorf("invalid descriptor: %w", err)
+		}
+		body, _, _ := strings.Cut(id, "#")
+		// ParseDescriptor already computed it
+		checksum, _ := DescriptorChecksum(body)
+		return body + "#" + checksum, nil
+	}
+	if IsPrivateKey(id) {
+		return "", errors.New("extended private keys can't be watched, use the extended public key")
+	}
+	if IsPubkey(id) {
+		if _, err := ParseExtendedKey(id); err != nil {
+			return "", fmt.Errorf("invalid extended public key: %w", err)
+		}
+		return id, nil
+	}
+	return ValidateAddress(id)
+}
+
+// privateKeyPrefixes are the prefixes of extended private keys
+// (BIP32, BIP49, BIP84 and their multisig versions, on every network)
+var privateKeyPrefixes = []string{
+	"xprv", "yprv", "zprv", "Yprv", "Zprv",
+	"tprv", "uprv", "vprv", "Uprv", "Vprv",
+}
+
+// IsPrivateKey returns whether an identifier is an extended private key
+func IsPrivateKey(id string) bool {
+	for _, prefix := range privateKeyPrefixes {
+		if strings.HasPrefix(id, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeIdentifier returns an identifier the way it's stored, so
+// requests can refer to a watch the same way it was added. Invalid
+// identifiers are only trimmed, since they can't be watched anyway.
+func NormalizeIdentifier(id string) string {
+	if normalized, err := ValidateIdentifier(id); err == nil {
+		return normalized
+	}
+	return strings.TrimSpace(id)
+}
+
+// identifierTables are the tables that refer to
+// watches by their identifier column
+var identifierTables = []interface{}{
+	&BalanceHistory{},
+	&WatchedTransaction{},
+	&AlertRule{},
+	&DustOutput{},
+	&DerivedAddress{},
+	&OutboxNotification{},
+}
+
+// NormalizeIdentifiers renames the watches that were stored before
+// identifiers were normalized (like descriptors without a checksum)
+// to their normalized identifier. A watch that's also stored under
+// its normalized identifier is left alone to be deleted by hand.
+func (w Watcher) NormalizeIdentifiers() error {
+	var identifiers []string
+	var addresses []string
+	if tx := w.DB.Model(&PubkeyInfo{}).Pluck("pubkey", &identifiers); tx.Error != nil {
+		return tx.Error
+	}
+	if tx := w.DB.Model(&AddressInfo{}).Pluck("address", &addresses); tx.Error != nil {
+		return tx.Error
+	}
+	identifiers = append(identifiers, addresses...)
+
+	for _, old := range identifiers {
+		normalized := NormalizeIdentifier(old)
+		if normalized == old {
+			continue
+		}
+		if w.IsWatched(normalized) {
+			log.Warnf("%s is watched twice, also as %s, delete one of them", old, normalized)
+			continue
+		}
+		err := w.DB.Transaction(func(tx *gorm.DB) error {
+			var info interface{} = &AddressInfo{}
+			column := "address"
+			if IsPubkey(old) {
+				info, column = &PubkeyInfo{}, "pubkey"
+			}
+			if err := tx.Model(info).Where(column+" = ?", old).Update(column, normalized).Error; err != nil {
+				return err
+			}
+			for _, table := range identifierTables {
+				if err := tx.Model(table).Where("identifier = ?", old).Update("identifier", normalized).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("unable to rename %s to %s: %w", old, normalized, err)
+		}
+		log.Infof("renamed %s to %s", old, normalized)
+	}
+	return nil
+}
+
+// ValidateAddress checks the checksum and encoding of an address,
+// returning segwit addresses in lowercase
+func ValidateAddress(address string) (string, error) {
+	lower := strings.ToLower(address)
+	for _, name := range []string{NetworkMainnet, NetworkTestnet, NetworkRegtest} {
+		if strings.HasPrefix(lower, networks[name].Bech32HRP+"1") {
+			return validateSegwitAddress(address)
+		}
+	}
+
+	data, err := Base58CheckDecode(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid address: %w", err)
+	}
+	if len(data) != addressHashLength+1 {
+		return "", fmt.Errorf("invalid address: %d bytes long, expected %d", len(data), addressHashLength+1)
+	}
+	version := data[0]
+	if version == chainParams.PubKeyHashID || version == chainParams.ScriptHashID {
+		return address, nil
+	}
+	others := otherNetworks(func(n Network) bool {
+		return n.PubKeyHashID == version || n.ScriptHashID == version
+	})
+	if others != "" {
+		return "", fmt.Errorf("%s is a %s address, but the network is %s", address, others, chainParams.Name)
+	}
+	return "", fmt.Errorf("invalid address: unknown version byte %02x", version)
+}
+
+// validateSegwitAddress checks a bech32 or bech32m address (BIP173, BIP350)
+func validateSegwitAddress(address string) (string, error) {
+	hrp, data, constant, err := Bech32Decode(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid segwit address: %w", err)
+	}
+	if hrp != chainParams.Bech32HRP {
+		others := otherNetworks(func(n Network) bool { return n.Bech32HRP == hrp })
+		return "", fmt.Errorf("%s is a %s address, but the network is %s", address, others, chainParams.Name)
+	}
+	if len(data) == 0 {
+		return "", errors.New("invalid segwit address: missing witness version")
+	}
+	version := data[0]
+	if version > 16 {
+		return "", fmt.Errorf("invalid segwit address: witness version %d is above 16", version)
+	}
+	program, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return "", fmt.Errorf("invalid segwit address: %w", err)
+	}
+	if len(program) < 2 || len(program) > 40 {
+		return "", fmt.Errorf("invalid segwit address: witness program is %d bytes, expected 2 to 40", len(program))
+	}
+	if version == 0 && len(program) != 20 && len(program) != 32 {
+		return "", fmt.Errorf("invalid segwit address: witness v0 program is %d bytes, expected 20 or 32", len(program))
+	}
+	if version == 0 && constant != Bech32Const {
+		return "", errors.New("invalid segwit address: witness v0 addresses must use bech32, not bech32m")
+	}
+	if version > 0 && constant != Bech32mConst {
+		return "", fmt.Errorf("invalid segwit address: witness v%d addresses must use bech32m, not bech32", version)
+	}
+	return strings.ToLower(address), nil
+}
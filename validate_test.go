@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeIdentifier(t *testing.T) {
+	descriptor := "wpkh(" + testBIP84Account + "/0/*)"
+	checksum, err := DescriptorChecksum(descriptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		identifier string
+		want       string
+	}{
+		{"segwit address", " BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4\n", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+		{"legacy address", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"},
+		{"extended key", " " + testBIP84Account, testBIP84Account},
+		{"descriptor", descriptor, descriptor + "#" + checksum},
+		{"descriptor with checksum", descriptor + "#" + checksum, descriptor + "#" + checksum},
+		{"invalid", " not an address ", "not an address"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := NormalizeIdentifier(test.identifier); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeIdentifiers(t *testing.T) {
+	w := Watcher{DB: newTestDB(t)}
+	descriptor := "wpkh(" + testBIP84Account + "/0/*)"
+	w.DB.Create(&PubkeyInfo{Pubkey: descriptor, Nickname: "wallet"})
+	w.DB.Create(&AlertRule{Identifier: descriptor, Type: RuleBalanceAbove, Value: 1})
+	w.DB.Create(&WatchedTransaction{Identifier: descriptor, TXID: "aa"})
+	w.DB.Create(&AddressInfo{Address: "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4"})
+
+	if err := w.NormalizeIdentifiers(); err != nil {
+		t.Fatal(err)
+	}
+	normalized := NormalizeIdentifier(descriptor)
+	if w.GetNickname(normalized) != "wallet" {
+		t.Errorf("descriptor wasn't renamed to %s", normalized)
+	}
+	if len(w.GetAlertRules(normalized)) != 1 || len(w.GetKnownTXIDs(normalized)) != 1 {
+		t.Error("rules and transactions weren't renamed with the descriptor")
+	}
+	if !w.IsWatched("bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4") {
+		t.Error("address wasn't renamed to lowercase")
+	}
+}
+
+func TestValidateIdentifierPrivateKeys(t *testing.T) {
+	tests := []struct {
+		name       string
+		identifier string
+		wantErr    bool
+	}{
+		{"extended private key", "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi", true},
+		{"multisig private key", "Zprvsomething", true},
+		{"testnet private key", "tprv8ZgxMBicQKsPd7Uf69XL1XwhmjHopUGep8GuEiJDZmbQz6o58LninorQAfcKZWARbtRtfnLcJ5MQ2AtHcQJCCRUcMRvmDUjyEmNUWwx8UbK", true},
+		{"address starting with 1prv", "1prvaaaaaaaaaaaaaaaaaaaaaaaZG8NwW", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ValidateIdentifier(test.identifier)
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want error %t", err, test.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "private") {
+				t.Errorf("got %v, want a private key error", err)
+			}
+		})
+	}
+}
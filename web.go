@@ -30,7 +30,21 @@ func InitFrontend(r *gin.Engine) {
 func InitBackend(r *gin.Engine) {
 	r.POST("/balance", watcher.GetBalance)
 	r.POST("/watch", watcher.AddWatch)
+	r.PUT("/watch", watcher.UpdateWatch)
 	r.GET("/balances", watcher.GetBalances)
+	r.POST("/history", watcher.GetHistory)
+	r.GET("/notifications", watcher.GetNotifications)
 	r.GET("/watches", watcher.GetWatches)
 	r.DELETE("/identifier", watcher.DeleteIdentifier)
+	r.POST("/pause", watcher.PauseWatch)
+	r.POST("/resume", watcher.ResumeWatch)
+	r.POST("/check", watcher.CheckWatchNow)
+	r.GET("/templates", watcher.GetTemplates)
+	r.POST("/template", watcher.SaveTemplate)
+	r.POST("/template/preview", watcher.PreviewTemplate)
+	r.DELETE("/template", watcher.DeleteTemplate)
+	r.GET("/rules", watcher.GetRules)
+	r.POST("/rule", watcher.SaveRule)
+	r.DELETE("/rule", watcher.DeleteRule)
+	r.GET("/dust", watcher.GetDust)
 }
\ No newline at end of file
@@ -1,23 +1,65 @@
 $(document).ready(function () {
-  function refreshAddresses() {
+  function refreshAddresses(selected) {
     // Populate addresses
     $.get("/balances", function (data) {
       options = "";
       if (data.addresses) {
         for (let i = 0; i < data.addresses.length; i++) {
+          let paused = data.addresses[i].Paused ? ", paused" : "";
           options =
             options +
-            `<option value="${data.addresses[i].Address}">${data.addresses[i].Nickname} (address)</option>`;
+            `<option value="${data.addresses[i].Address}">${data.addresses[i].Nickname} (address${paused})</option>`;
         }
       }
       if (data.pubkeys) {
         for (let i = 0; i < data.pubkeys.length; i++) {
+          let kind = data.pubkeys[i].Pubkey.includes("(") ? "descriptor" : "pubkey";
+          let paused = data.pubkeys[i].Paused ? ", paused" : "";
           options =
             options +
-            `<option value="${data.pubkeys[i].Pubkey}">${data.pubkeys[i].Nickname} (pubkey)</option>`;
+            `<option value="${data.pubkeys[i].Pubkey}">${data.pubkeys[i].Nickname} (${kind}${paused})</option>`;
         }
       }
       $("#addresses").html(options);
+      if (selected) {
+        $("#addresses").val(selected);
+      }
+    });
+  }
+
+  function refreshTemplates() {
+    // Populate template choices
+    $.get("/templates", function (data) {
+      templates = data;
+      options = "";
+      for (let i = 0; i < data.length; i++) {
+        options =
+          options + `<option value="${data[i].Name}">${data[i].Name}</option>`;
+      }
+      $("#template").html(`<option value="">default</option>` + options);
+      $("#templates").html(`<option value="">new template</option>` + options);
+    });
+  }
+
+  function showTemplateStatus(message) {
+    $("#template-status").html(message).css("opacity", "100%");
+    $("#template-status").delay(2000).animate({ opacity: "40%" });
+  }
+
+  function refreshRules(identifier) {
+    // Populate the alert rules of the selected watch
+    $.get("/rules", { identifier: identifier }, function (data) {
+      rules = "";
+      for (let i = 0; i < data.length; i++) {
+        value = data[i].type == "outgoing" ? "" : data[i].value;
+        rules =
+          rules +
+          `<li>${data[i].type} ${value} <button class="remove-rule" value="${data[i].id}">Remove</button></li>`;
+      }
+      if (rules == "") {
+        rules = "<li>none, every balance change is notified</li>";
+      }
+      $("#rules").html(rules);
     });
   }
 
@@ -35,18 +77,45 @@ $(document).ready(function () {
       }
       entry = `<div class="address-entry">
         <b>Address: </b>${address}<br>
+        <b>Status: </b>${resp.Paused ? "paused" : "watching"}<br>
         <b>Balance: </b>${resp.BalanceSat} satoshis<br>
+        <b>Confirmed Balance: </b>${resp.ConfirmedBalanceSat} satoshis<br>
+        <b>Pending Balance: </b>${resp.PendingBalanceSat} satoshis<br>
+        <b>Spendable Balance: </b>${resp.SpendableBalanceSat} satoshis<br>
         <b>Previous Balance: </b>${resp.PreviousBalanceSat} satoshis<br>
         <b>Value: </b>${resp.BalanceCurrency} ${resp.Currency}<br>
         <b>Previous Value: </b>${resp.PreviousBalanceCurrency} ${resp.Currency}<br>
         <b>Transactions: </b>${resp.TXCount}<br>
+        <b>Notifiers: </b>${resp.Notifiers || "default"}<br>
+        <b>Template: </b>${resp.Template || "default"}<br>
+        <b>Confirmation Milestones: </b>${resp.Milestones || "default"}<br>
+        <b>Interval: </b>${resp.Interval ? resp.Interval + " seconds" : "default"}<br>
+        <b>Alert Rules: </b><ul id="rules"></ul>
+        <select id="rule-type">
+          <option value="balance_above">balance above (sats)</option>
+          <option value="balance_below">balance below (sats)</option>
+          <option value="fiat_above">balance above (${resp.Currency})</option>
+          <option value="fiat_below">balance below (${resp.Currency})</option>
+          <option value="change_sats">change of at least (sats)</option>
+          <option value="change_percent">change of at least (%)</option>
+          <option value="outgoing">any outgoing spend</option>
+        </select>
+        <input id="rule-value" value="" size="10" />
+        <button id="add-rule">Add rule</button>
+        <p id="rule-status"></p>
+        <button id="${resp.Paused ? "resume" : "pause"}">${resp.Paused ? "Resume" : "Pause"}</button>
+        <button id="check-now"${resp.Paused ? " disabled" : ""}>Check now</button>
+        <p id="control-status"></p>
         <button id="remove">Remove this address</button>
         <p id="delete-status"></p>
       </div>`;
       $("#address-info").html(entry);
+      refreshRules(address);
     });
   }
+  var templates = [];
   refreshAddresses();
+  refreshTemplates();
 
   $("#addresses").click(function (e) {
     if (e.target.tagName == "SELECT") {
@@ -60,9 +129,20 @@ $(document).ready(function () {
   $("#add").click(function () {
     identifier = $("#identifier").val();
     nickname = $("#nickname").val();
+    notifiers = $("#notifiers").val();
+    template = $("#template").val();
+    milestones = $("#milestones").val();
+    interval = parseInt($("#interval").val()) || 0;
     $.post(
       "/watch",
-      JSON.stringify({ Identifier: identifier, Nickname: nickname })
+      JSON.stringify({
+        Identifier: identifier,
+        Nickname: nickname,
+        Notifiers: notifiers,
+        Template: template,
+        Milestones: milestones,
+        Interval: interval,
+      })
     ).always(function (data) {
       message = "Success";
       if (data.responseJSON != null && data.responseJSON.errors) {
@@ -94,4 +174,128 @@ $(document).ready(function () {
       refreshAddresses();
     });
   });
+
+  function controlWatch(url) {
+    identifier = $("#addresses :selected").val();
+    $.post(url, JSON.stringify({ Identifier: identifier })).always(function (
+      data
+    ) {
+      if (data.responseJSON != null && data.responseJSON.errors) {
+        $("#control-status").html(data.responseJSON.errors);
+        return;
+      }
+      if (url == "/check") {
+        $("#control-status").html("Checking").css("opacity", "100%");
+        $("#control-status").delay(2000).animate({ opacity: "40%" });
+        return;
+      }
+      getAddressDetails();
+      refreshAddresses(identifier);
+    });
+  }
+
+  $(document).on("click", "#pause", function () {
+    controlWatch("/pause");
+  });
+
+  $(document).on("click", "#resume", function () {
+    controlWatch("/resume");
+  });
+
+  $(document).on("click", "#check-now", function () {
+    controlWatch("/check");
+  });
+
+  $(document).on("click", "#add-rule", function () {
+    identifier = $("#addresses :selected").val();
+    $.post(
+      "/rule",
+      JSON.stringify({
+        Identifier: identifier,
+        Type: $("#rule-type").val(),
+        Value: parseFloat($("#rule-value").val()) || 0,
+      })
+    ).always(function (data) {
+      message = "Added";
+      if (data.responseJSON != null && data.responseJSON.errors) {
+        message = data.responseJSON.errors;
+      } else {
+        $("#rule-value").val("");
+        refreshRules(identifier);
+      }
+      $("#rule-status").html(message).css("opacity", "100%");
+      $("#rule-status").delay(2000).animate({ opacity: "40%" });
+    });
+  });
+
+  $(document).on("click", ".remove-rule", function () {
+    identifier = $("#addresses :selected").val();
+    $.ajax({
+      type: "DELETE",
+      url: "/rule",
+      data: JSON.stringify({ ID: parseInt($(this).val()) }),
+    }).done(function () {
+      refreshRules(identifier);
+    });
+  });
+
+  $("#templates").change(function () {
+    name = $("#templates").val();
+    selected = templates.find((t) => t.Name == name) || {};
+    $("#template-name").val(selected.Name || "");
+    $("#template-notifiers").val(selected.Notifiers || "");
+    $("#template-body").val(selected.Body || "");
+    $("#template-preview").html("");
+  });
+
+  $("#save-template").click(function () {
+    $.post(
+      "/template",
+      JSON.stringify({
+        Name: $("#template-name").val(),
+        Notifiers: $("#template-notifiers").val(),
+        Body: $("#template-body").val(),
+      })
+    ).always(function (data) {
+      message = "Saved";
+      if (data.responseJSON != null && data.responseJSON.errors) {
+        message = data.responseJSON.errors;
+      } else {
+        refreshTemplates();
+      }
+      showTemplateStatus(message);
+    });
+  });
+
+  $("#preview-template").click(function () {
+    identifier = $("#addresses :selected").val();
+    if (!identifier) {
+      showTemplateStatus("Select a watch to preview the template with");
+      return;
+    }
+    $.post(
+      "/template/preview",
+      JSON.stringify({
+        Identifier: identifier,
+        Body: $("#template-body").val(),
+      })
+    ).always(function (data) {
+      if (data.responseJSON != null && data.responseJSON.errors) {
+        showTemplateStatus(data.responseJSON.errors);
+        return;
+      }
+      $("#template-preview").text(data.message);
+    });
+  });
+
+  $("#delete-template").click(function () {
+    $.ajax({
+      type: "DELETE",
+      url: "/template",
+      data: JSON.stringify({ Name: $("#template-name").val() }),
+    }).done(function (data) {
+      showTemplateStatus(data ? "Deleted" : "Failure");
+      refreshTemplates();
+    });
+  });
 });
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	NotifierWebhook string = "webhook"
+
+	// WebhookEventVersion is incremented when WebhookEvent changes
+	// in a way that isn't backwards compatible
+	WebhookEventVersion     int    = 1
+	WebhookEventBalance     string = "balance.changed"
+	WebhookEventUnconfirmed string = "transaction.unconfirmed"
+	WebhookEventConfirmed   string = "transaction.confirmed"
+	WebhookEventMilestone   string = "transaction.milestone"
+	WebhookEventReorg       string = "transaction.reorged"
+	WebhookEventDust        string = "transaction.dust"
+	WebhookSignatureHeader  string = "X-Signature-256"
+)
+
+// webhookEventNames maps BalanceEvent types to WebhookEvent names
+var webhookEventNames = map[string]string{
+	EventBalanceChanged: WebhookEventBalance,
+	EventUnconfirmed:    WebhookEventUnconfirmed,
+	EventConfirmed:      WebhookEventConfirmed,
+	EventMilestone:      WebhookEventMilestone,
+	EventReorg:          WebhookEventReorg,
+	EventDust:           WebhookEventDust,
+}
+
+// WebhookEvent is the versioned JSON body sent by the webhook notifier
+type WebhookEvent struct {
+	Version                 int                  `json:"version"`
+	Event                   string               `json:"event"`
+	Kind                    string               `json:"kind"`
+	Network                 string               `json:"network"`
+	Identifier              string               `json:"identifier"`
+	Nickname                string               `json:"nickname"`
+	PreviousBalanceSat      int                  `json:"previousBalanceSat"`
+	BalanceSat              int                  `json:"balanceSat"`
+	ConfirmedBalanceSat     int                  `json:"confirmedBalanceSat"`
+	PendingBalanceSat       int                  `json:"pendingBalanceSat"`
+	SpendableBalanceSat     int                  `json:"spendableBalanceSat"`
+	Currency                string               `json:"currency"`
+	PreviousBalanceCurrency string               `json:"previousBalanceCurrency"`
+	BalanceCurrency         string               `json:"balanceCurrency"`
+	TXCount                 int                  `json:"txCount"`
+	Transactions            []WatchedTransaction `json:"transactions"`
+	Milestone               int                  `json:"milestone,omitempty"`
+	Priority                string               `json:"priority"`
+	Timestamp               string               `json:"timestamp"`
+}
+
+// WebhookNotifier POSTs signed JSON events to any URL.
+// WebhookNotifier implements the Notifier interface
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+}
+
+// NewWebhookNotifier creates a WebhookNotifier from the configuration
+func NewWebhookNotifier(c Config) (Notifier, error) {
+	if c.WebhookURL == "" {
+		return nil, errors.New("WEBHOOK_URL is not set")
+	}
+	if c.WebhookSecret == "" {
+		return nil, errors.New("WEBHOOK_SECRET is not set")
+	}
+	return WebhookNotifier{URL: c.WebhookURL, Secret: c.WebhookSecret}, nil
+}
+
+// Name returns the name of the notifier
+func (wn WebhookNotifier) Name() string {
+	return NotifierWebhook
+}
+
+// Notify POSTs a BalanceEvent as a WebhookEvent with an HMAC-SHA256
+// signature of the body in the X-Signature-256 header
+func (wn WebhookNotifier) Notify(ctx context.Context, e BalanceEvent) error {
+	body, err := json.Marshal(WebhookEvent{
+		Version:                 WebhookEventVersion,
+		Event:                   webhookEventNames[e.Type],
+		Kind:                    e.Kind,
+		Network:                 e.Network,
+		Identifier:              e.Identifier,
+		Nickname:                e.Nickname,
+		PreviousBalanceSat:      e.PreviousBalanceSat,
+		BalanceSat:              e.BalanceSat,
+		ConfirmedBalanceSat:     e.ConfirmedBalanceSat,
+		PendingBalanceSat:       e.PendingBalanceSat,
+		SpendableBalanceSat:     e.SpendableBalanceSat,
+		Currency:                e.Currency,
+		PreviousBalanceCurrency: e.PreviousBalanceCurrency,
+		BalanceCurrency:         e.BalanceCurrency,
+		TXCount:                 e.TXCount,
+		Transactions:            e.Transactions,
+		Milestone:               e.Milestone,
+		Priority:                e.Priority,
+		Timestamp:               e.Time.UTC().Format(TimeFormatter),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to encode payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wn.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, "sha256="+wn.Sign(body))
+
+	client := http.Client{Timeout: NotifierTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("error calling webhook: %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body using the shared secret
+func (wn WebhookNotifier) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(wn.Secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookSign(t *testing.T) {
+	// RFC 4231 test case 2
+	wn := WebhookNotifier{Secret: "Jefe"}
+	got := wn.Sign([]byte("what do ya want for nothing?"))
+	want := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestWebhookNotifierNotify(t *testing.T) {
+	const secret = "s3cr3t"
+	var signature string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(WebhookSignatureHeader)
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	notifier, err := NewWebhookNotifier(Config{WebhookURL: server.URL, WebhookSecret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := BalanceEvent{
+		Type:       EventUnconfirmed,
+		Kind:       KindAddress,
+		Identifier: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+		BalanceSat: 1000,
+		Time:       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if err := notifier.Notify(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+
+	// The receiver verifies the signature with the shared secret
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("got signature %q, want %q", signature, want)
+	}
+
+	var event WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Version != WebhookEventVersion || event.Event != WebhookEventUnconfirmed ||
+		event.Identifier != e.Identifier || event.BalanceSat != 1000 ||
+		event.Timestamp != e.Time.Format(TimeFormatter) {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestWebhookNotifierError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	notifier := WebhookNotifier{URL: server.URL, Secret: "s3cr3t"}
+	if err := notifier.Notify(context.Background(), BalanceEvent{}); err == nil {
+		t.Error("an unsuccessful response wasn't an error")
+	}
+}